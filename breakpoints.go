@@ -0,0 +1,782 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// The keys breakpoint results are recorded under for breakpoints that aren't
+// in a source file, which are keyed by the file's path.
+const (
+	functionBreakpointsKey    = "function"
+	dataBreakpointsKey        = "data"
+	instructionBreakpointsKey = "instruction"
+)
+
+type SourceBreakpoint struct {
+	Line         int    `json:"line"`
+	Column       int    `json:"column,omitempty"`
+	Condition    string `json:"condition,omitempty"`
+	HitCondition string `json:"hitCondition,omitempty"`
+	// LogMessage makes the breakpoint a logpoint, which logs the message
+	// instead of stopping.
+	LogMessage string `json:"logMessage,omitempty"`
+}
+
+type SetBreakpointsArgs struct {
+	Source      Source             `json:"source"`
+	Breakpoints []SourceBreakpoint `json:"breakpoints"`
+}
+
+type Breakpoint struct {
+	ID       int     `json:"id"`
+	Verified bool    `json:"verified"`
+	Message  string  `json:"message"`
+	Source   *Source `json:"source"`
+	Line     int     `json:"line"`
+	Column   int     `json:"column"`
+}
+
+type SetBreakpointsResponseBody struct {
+	Breakpoints []Breakpoint `json:"breakpoints"`
+}
+
+func SetBreakpointsRequest(args SetBreakpointsArgs) Request {
+	return Request{
+		ProtocolMessage: NewRequest(),
+		Command:         "setBreakpoints",
+		Arguments:       args,
+	}
+}
+
+type ExceptionFilterOptions struct {
+	FilterID  string `json:"filterId"`
+	Condition string `json:"condition,omitempty"`
+}
+
+type SetExceptionBreakpointsArgs struct {
+	Filters       []string                 `json:"filters"`
+	FilterOptions []ExceptionFilterOptions `json:"filterOptions,omitempty"`
+}
+
+func SetExceptionBreakpointsRequest(args SetExceptionBreakpointsArgs) Request {
+	return Request{
+		ProtocolMessage: NewRequest(),
+		Command:         "setExceptionBreakpoints",
+		Arguments:       args,
+	}
+}
+
+type FunctionBreakpoint struct {
+	Name         string `json:"name"`
+	Condition    string `json:"condition,omitempty"`
+	HitCondition string `json:"hitCondition,omitempty"`
+}
+
+type SetFunctionBreakpointsArgs struct {
+	Breakpoints []FunctionBreakpoint `json:"breakpoints"`
+}
+
+func SetFunctionBreakpointsRequest(args SetFunctionBreakpointsArgs) Request {
+	return Request{
+		ProtocolMessage: NewRequest(),
+		Command:         "setFunctionBreakpoints",
+		Arguments:       args,
+	}
+}
+
+type BreakpointLocationsArgs struct {
+	Source  Source `json:"source"`
+	Line    int    `json:"line"`
+	EndLine int    `json:"endLine,omitempty"`
+}
+
+type BreakpointLocation struct {
+	Line      int `json:"line"`
+	Column    int `json:"column"`
+	EndLine   int `json:"endLine"`
+	EndColumn int `json:"endColumn"`
+}
+
+type BreakpointLocationsResponseBody struct {
+	Breakpoints []BreakpointLocation `json:"breakpoints"`
+}
+
+func BreakpointLocationsRequest(args BreakpointLocationsArgs) Request {
+	return Request{
+		ProtocolMessage: NewRequest(),
+		Command:         "breakpointLocations",
+		Arguments:       args,
+	}
+}
+
+// parseLocation parses a location of the form file:line. The file is
+// returned as an absolute path.
+func parseLocation(s string) (string, int, error) {
+	i := strings.LastIndex(s, ":")
+	if i < 0 {
+		return "", 0, fmt.Errorf("expected file:line, got %q", s)
+	}
+	line, err := strconv.Atoi(s[i+1:])
+	if err != nil {
+		return "", 0, fmt.Errorf("bad line number: %s", err)
+	}
+	path, err := filepath.Abs(s[:i])
+	if err != nil {
+		return "", 0, err
+	}
+	return path, line, nil
+}
+
+// setBreakpoints sends the full set of breakpoints for the file at path,
+// replacing any that were set before.
+func setBreakpoints(s *Session, path string, bps []SourceBreakpoint) error {
+	results, err := sendBreakpoints(s, path, bps)
+	if err != nil {
+		return err
+	}
+	s.setBreakpointResults(path, results)
+	for _, bp := range results {
+		reportBreakpoint(s, bp, fmt.Sprintf("%s:%d", filepath.Base(path), displayLine(s, bp.Line)))
+	}
+	return nil
+}
+
+// sendBreakpoints sends the full set of breakpoints for the file at path,
+// and returns what the adapter made of them, without reporting them.
+func sendBreakpoints(s *Session, path string, bps []SourceBreakpoint) ([]Breakpoint, error) {
+	req := SetBreakpointsRequest(SetBreakpointsArgs{
+		Source:      Source{Name: filepath.Base(path), Path: path},
+		Breakpoints: bps,
+	})
+	resp, err := sendAndWait(s, req)
+	if err != nil {
+		return nil, err
+	}
+	var body SetBreakpointsResponseBody
+	if err := json.Unmarshal(resp.Body, &body); err != nil {
+		return nil, fmt.Errorf("failed to read breakpoints: %s", err)
+	}
+	return body.Breakpoints, nil
+}
+
+// reportBreakpoint prints whether the adapter verified the breakpoint at
+// the given location, and remembers it so later breakpoint events can be
+// reported the same way.
+func reportBreakpoint(s *Session, bp Breakpoint, where string) {
+	s.setBreakpointStatus(bp, where)
+	status := "verified"
+	if !bp.Verified {
+		status = "unverified"
+		if bp.Message != "" {
+			status += ": " + bp.Message
+		}
+	}
+	fmt.Fprintf(s.opts.Out, "breakpoint %d at %s %s\n", bp.ID, where, status)
+}
+
+// BreakpointEventBody is the body of the breakpoint event. Reason is one of
+// changed, new, or removed.
+type BreakpointEventBody struct {
+	Reason     string     `json:"reason"`
+	Breakpoint Breakpoint `json:"breakpoint"`
+}
+
+func handleBreakpointEvent(s *Session, event Event) {
+	var body BreakpointEventBody
+	if err := json.Unmarshal(event.Body, &body); err != nil {
+		log.Printf("failed to read breakpoint event: %s", err)
+		return
+	}
+	bp := body.Breakpoint
+	where, wasVerified, known := s.updateBreakpointStatus(body.Reason, bp)
+	if bp.Source != nil && bp.Line != 0 {
+		where = formatLocation(s, bp.Source, bp.Line)
+	}
+	if body.Reason == "changed" && known && !wasVerified && bp.Verified {
+		fmt.Fprintf(s.opts.Out, "breakpoint at %s verified\n", where)
+	}
+}
+
+// parseBreakpointConditions parses the optional conditions that follow a
+// breakpoint's location, of the form [hit <op><count>] [if <expression>].
+func parseBreakpointConditions(s string) (condition, hitCondition string, err error) {
+	s = strings.TrimSpace(s)
+	if strings.HasPrefix(s, "hit") && (len(s) == 3 || !isIdentRune(rune(s[3]))) {
+		s = strings.TrimLeft(s[3:], " ")
+		op := s[:len(s)-len(strings.TrimLeft(s, "<>=!%"))]
+		s = strings.TrimLeft(s[len(op):], " ")
+		count := s[:len(s)-len(strings.TrimLeft(s, "0123456789"))]
+		if count == "" {
+			return "", "", fmt.Errorf("expected a hit count, as in hit>=3")
+		}
+		hitCondition = op + count
+		s = strings.TrimSpace(s[len(count):])
+	}
+	if s == "if" || strings.HasPrefix(s, "if ") {
+		condition = strings.TrimSpace(s[2:])
+		if condition == "" {
+			return "", "", fmt.Errorf("expected a condition after if")
+		}
+		s = ""
+	}
+	if s != "" {
+		return "", "", fmt.Errorf("unexpected %q after location", s)
+	}
+	return condition, hitCondition, nil
+}
+
+// supportedConditions drops, with a warning, any breakpoint conditions the
+// adapter can't handle.
+func supportedConditions(s *Session, condition, hitCondition string) (string, string) {
+	caps := s.getCapabilities()
+	if condition != "" && !caps.SupportsConditionalBreakpoints {
+		fmt.Fprintln(s.opts.Out, "warning: adapter does not support conditional breakpoints; ignoring condition")
+		condition = ""
+	}
+	if hitCondition != "" && !caps.SupportsHitConditionalBreakpoints {
+		fmt.Fprintln(s.opts.Out, "warning: adapter does not support hit count breakpoints; ignoring hit count")
+		hitCondition = ""
+	}
+	return condition, hitCondition
+}
+
+func breakCommand(s *Session, args []string) error {
+	if len(args) == 0 {
+		return errors.New("usage: break <file>:<line> [hit <op><count>] [if <condition>]")
+	}
+	path, line, err := parseLocation(args[0])
+	if err != nil {
+		return err
+	}
+	condition, hitCondition, err := parseBreakpointConditions(strings.Join(args[1:], " "))
+	if err != nil {
+		return err
+	}
+	condition, hitCondition = supportedConditions(s, condition, hitCondition)
+	bps := s.addBreakpoint(path, SourceBreakpoint{
+		Line:         protocolLine(s, line),
+		Condition:    condition,
+		HitCondition: hitCondition,
+	})
+	if !s.isConfigured() {
+		fmt.Fprintf(s.opts.Out, "breakpoint at %s:%d will be set when the session starts\n", filepath.Base(path), line)
+		return nil
+	}
+	return setBreakpoints(s, path, bps)
+}
+
+func clearCommand(s *Session, args []string) error {
+	if len(args) > 1 {
+		return errors.New("usage: clear [<n> | <file>[:<line>]]")
+	}
+	if len(args) == 1 {
+		if n, err := strconv.Atoi(args[0]); err == nil {
+			return clearNumbered(s, n)
+		}
+	}
+	if len(args) == 1 && strings.Contains(args[0], ":") {
+		if path, line, err := parseLocation(args[0]); err == nil {
+			return clearBreakpoint(s, path, line)
+		}
+	}
+	var path string
+	if len(args) == 1 {
+		var err error
+		if path, err = filepath.Abs(args[0]); err != nil {
+			return err
+		}
+	}
+	removed := s.clearBreakpoints(path)
+	if len(removed) == 0 {
+		fmt.Fprintln(s.opts.Out, "no breakpoints to clear")
+		return nil
+	}
+	paths := make([]string, 0, len(removed))
+	for p := range removed {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+	for _, p := range paths {
+		for _, bp := range removed[p] {
+			fmt.Fprintf(s.opts.Out, "removed breakpoint at %s:%d\n", filepath.Base(p), displayLine(s, bp.Line))
+		}
+		if s.isConfigured() {
+			// An empty list clears the file; nil would be sent as null.
+			if err := setBreakpoints(s, p, []SourceBreakpoint{}); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// clearBreakpoint removes the breakpoint at line of path, and sends the
+// file's remaining breakpoints.
+func clearBreakpoint(s *Session, path string, line int) error {
+	bps, ok := s.removeBreakpoint(path, protocolLine(s, line))
+	if !ok {
+		return fmt.Errorf("no breakpoint at %s:%d", filepath.Base(path), line)
+	}
+	fmt.Fprintf(s.opts.Out, "removed breakpoint at %s:%d\n", filepath.Base(path), line)
+	if !s.isConfigured() {
+		return nil
+	}
+	return setBreakpoints(s, path, bps)
+}
+
+// setExceptionBreakpoints sends the full set of enabled exception filters.
+func setExceptionBreakpoints(s *Session, filters []string) error {
+	req := SetExceptionBreakpointsRequest(SetExceptionBreakpointsArgs{Filters: filters})
+	_, err := sendAndWait(s, req)
+	return err
+}
+
+// printExceptionFilters lists the given filters, marking the enabled ones.
+func printExceptionFilters(s *Session, filters []ExceptionBreakpointsFilter) {
+	enabled := make(map[string]bool)
+	for _, filter := range s.getExceptionFilters() {
+		enabled[filter] = true
+	}
+	for _, filter := range filters {
+		mark := " "
+		if enabled[filter.Filter] {
+			mark = "x"
+		}
+		fmt.Fprintf(s.opts.Out, "[%s] %s: %s\n", mark, filter.Filter, filter.Label)
+		if filter.Description != "" {
+			fmt.Fprintf(s.opts.Out, "      %s\n", filter.Description)
+		}
+	}
+}
+
+func catchCommand(s *Session, args []string) error {
+	available := s.getCapabilities().ExceptionBreakpointFilters
+	if len(available) == 0 {
+		return errors.New("adapter has no exception breakpoint filters")
+	}
+	if len(args) == 0 {
+		printExceptionFilters(s, available)
+		return nil
+	}
+	if len(args) != 1 {
+		return errors.New("usage: catch [filter]")
+	}
+	found := false
+	for _, filter := range available {
+		if filter.Filter == args[0] {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return fmt.Errorf("unknown exception filter %q; run catch to list them", args[0])
+	}
+	if s.toggleExceptionFilter(args[0]) {
+		fmt.Fprintf(s.opts.Out, "catching %s exceptions\n", args[0])
+	} else {
+		fmt.Fprintf(s.opts.Out, "no longer catching %s exceptions\n", args[0])
+	}
+	if !s.isConfigured() {
+		return nil
+	}
+	return setExceptionBreakpoints(s, s.getExceptionFilters())
+}
+
+// setFunctionBreakpoints sends the full set of function breakpoints,
+// replacing any that were set before.
+func setFunctionBreakpoints(s *Session, bps []FunctionBreakpoint) error {
+	resp, err := sendAndWait(s, SetFunctionBreakpointsRequest(SetFunctionBreakpointsArgs{Breakpoints: bps}))
+	if err != nil {
+		return err
+	}
+	var body SetBreakpointsResponseBody
+	if err := json.Unmarshal(resp.Body, &body); err != nil {
+		return fmt.Errorf("failed to read breakpoints: %s", err)
+	}
+	s.setBreakpointResults(functionBreakpointsKey, body.Breakpoints)
+	// The response has one breakpoint for each requested, in order.
+	for i, bp := range body.Breakpoints {
+		if i < len(bps) {
+			reportBreakpoint(s, bp, bps[i].Name)
+		}
+	}
+	return nil
+}
+
+func fbreakCommand(s *Session, args []string) error {
+	if len(args) != 1 {
+		return errors.New("usage: fbreak <function>")
+	}
+	if err := checkSupported(s, "setFunctionBreakpoints"); err != nil {
+		return err
+	}
+	bps := s.addFunctionBreakpoint(FunctionBreakpoint{Name: args[0]})
+	if !s.isConfigured() {
+		fmt.Fprintf(s.opts.Out, "breakpoint at %s will be set when the session starts\n", args[0])
+		return nil
+	}
+	return setFunctionBreakpoints(s, bps)
+}
+
+func blocsCommand(s *Session, args []string) error {
+	if len(args) < 2 || len(args) > 3 {
+		return errors.New("usage: blocs <file> <line> [end-line]")
+	}
+	if checkSupported(s, "breakpointLocations") != nil {
+		fmt.Fprintln(s.opts.Out, "adapter can't list breakpoint locations; breakpoints set with break may not verify on lines without code")
+		return nil
+	}
+	path, err := filepath.Abs(args[0])
+	if err != nil {
+		return err
+	}
+	var lines []int
+	for _, arg := range args[1:] {
+		line, err := strconv.Atoi(arg)
+		if err != nil {
+			return fmt.Errorf("bad line number %q", arg)
+		}
+		lines = append(lines, protocolLine(s, line))
+	}
+	locArgs := BreakpointLocationsArgs{
+		Source: Source{Name: filepath.Base(path), Path: path},
+		Line:   lines[0],
+	}
+	if len(lines) > 1 {
+		locArgs.EndLine = lines[1]
+	}
+	resp, err := sendAndWait(s, BreakpointLocationsRequest(locArgs))
+	if err != nil {
+		return err
+	}
+	var body BreakpointLocationsResponseBody
+	if err := json.Unmarshal(resp.Body, &body); err != nil {
+		return fmt.Errorf("failed to read breakpoint locations: %s", err)
+	}
+	if len(body.Breakpoints) == 0 {
+		fmt.Fprintln(s.opts.Out, "no valid breakpoint locations in range")
+		return nil
+	}
+	for _, loc := range body.Breakpoints {
+		fmt.Fprintf(s.opts.Out, "(%d, %d)\n", displayLine(s, loc.Line), loc.Column)
+	}
+	return nil
+}
+
+type DataBreakpointInfoArgs struct {
+	VariablesReference int    `json:"variablesReference,omitempty"`
+	Name               string `json:"name"`
+}
+
+type DataBreakpointInfoResponseBody struct {
+	// DataID is null if no data breakpoint can be set on the variable.
+	DataID      *string  `json:"dataId"`
+	Description string   `json:"description"`
+	AccessTypes []string `json:"accessTypes,omitempty"`
+	CanPersist  bool     `json:"canPersist,omitempty"`
+}
+
+func DataBreakpointInfoRequest(args DataBreakpointInfoArgs) Request {
+	return Request{
+		ProtocolMessage: NewRequest(),
+		Command:         "dataBreakpointInfo",
+		Arguments:       args,
+	}
+}
+
+type DataBreakpoint struct {
+	DataID string `json:"dataId"`
+	// AccessType is one of read, write, or readWrite.
+	AccessType   string `json:"accessType,omitempty"`
+	Condition    string `json:"condition,omitempty"`
+	HitCondition string `json:"hitCondition,omitempty"`
+}
+
+type SetDataBreakpointsArgs struct {
+	Breakpoints []DataBreakpoint `json:"breakpoints"`
+}
+
+func SetDataBreakpointsRequest(args SetDataBreakpointsArgs) Request {
+	return Request{
+		ProtocolMessage: NewRequest(),
+		Command:         "setDataBreakpoints",
+		Arguments:       args,
+	}
+}
+
+// watchCommand sets a data breakpoint on a variable, so that execution stops
+// when it's accessed.
+func watchCommand(s *Session, args []string) error {
+	if len(args) < 2 || len(args) > 3 {
+		return errors.New("usage: watch <ref> <name> [read|write|readWrite]")
+	}
+	ref, err := strconv.Atoi(args[0])
+	if err != nil {
+		return fmt.Errorf("bad variables reference %q", args[0])
+	}
+	if err := checkSupported(s, "dataBreakpointInfo"); err != nil {
+		return err
+	}
+	name := args[1]
+	resp, err := sendAndWait(s, DataBreakpointInfoRequest(DataBreakpointInfoArgs{VariablesReference: ref, Name: name}))
+	if err != nil {
+		return err
+	}
+	var info DataBreakpointInfoResponseBody
+	if err := json.Unmarshal(resp.Body, &info); err != nil {
+		return fmt.Errorf("failed to read data breakpoint info: %s", err)
+	}
+	if info.DataID == nil {
+		return fmt.Errorf("can't watch %s: %s", name, info.Description)
+	}
+	if len(info.AccessTypes) > 0 {
+		fmt.Fprintf(s.opts.Out, "%s supports %s access\n", info.Description, strings.Join(info.AccessTypes, ", "))
+	}
+	bp := DataBreakpoint{DataID: *info.DataID}
+	if len(args) == 3 {
+		bp.AccessType = args[2]
+	}
+	return setDataBreakpoints(s, s.addDataBreakpoint(bp))
+}
+
+// setDataBreakpoints sends the full set of data breakpoints, replacing any
+// that were set before.
+func setDataBreakpoints(s *Session, bps []DataBreakpoint) error {
+	resp, err := sendAndWait(s, SetDataBreakpointsRequest(SetDataBreakpointsArgs{Breakpoints: bps}))
+	if err != nil {
+		return err
+	}
+	var body SetBreakpointsResponseBody
+	if err := json.Unmarshal(resp.Body, &body); err != nil {
+		return fmt.Errorf("failed to read breakpoints: %s", err)
+	}
+	s.setBreakpointResults(dataBreakpointsKey, body.Breakpoints)
+	// The response has one breakpoint for each requested, in order.
+	for i, bp := range body.Breakpoints {
+		if i < len(bps) {
+			reportBreakpoint(s, bp, bps[i].DataID)
+		}
+	}
+	return nil
+}
+
+type InstructionBreakpoint struct {
+	InstructionReference string `json:"instructionReference"`
+	Offset               int    `json:"offset,omitempty"`
+	Condition            string `json:"condition,omitempty"`
+	HitCondition         string `json:"hitCondition,omitempty"`
+}
+
+type SetInstructionBreakpointsArgs struct {
+	Breakpoints []InstructionBreakpoint `json:"breakpoints"`
+}
+
+func SetInstructionBreakpointsRequest(args SetInstructionBreakpointsArgs) Request {
+	return Request{
+		ProtocolMessage: NewRequest(),
+		Command:         "setInstructionBreakpoints",
+		Arguments:       args,
+	}
+}
+
+// ibreakCommand sets a breakpoint on an instruction, such as one listed by
+// disas.
+func ibreakCommand(s *Session, args []string) error {
+	if len(args) == 0 {
+		return errors.New("usage: ibreak <address> [hit <op><count>] [if <condition>]")
+	}
+	if err := checkSupported(s, "setInstructionBreakpoints"); err != nil {
+		return err
+	}
+	condition, hitCondition, err := parseBreakpointConditions(strings.Join(args[1:], " "))
+	if err != nil {
+		return err
+	}
+	condition, hitCondition = supportedConditions(s, condition, hitCondition)
+	return setInstructionBreakpoints(s, s.addInstructionBreakpoint(InstructionBreakpoint{
+		InstructionReference: args[0],
+		Condition:            condition,
+		HitCondition:         hitCondition,
+	}))
+}
+
+// setInstructionBreakpoints sends the full set of instruction breakpoints,
+// replacing any that were set before.
+func setInstructionBreakpoints(s *Session, bps []InstructionBreakpoint) error {
+	resp, err := sendAndWait(s, SetInstructionBreakpointsRequest(SetInstructionBreakpointsArgs{Breakpoints: bps}))
+	if err != nil {
+		return err
+	}
+	var body SetBreakpointsResponseBody
+	if err := json.Unmarshal(resp.Body, &body); err != nil {
+		return fmt.Errorf("failed to read breakpoints: %s", err)
+	}
+	s.setBreakpointResults(instructionBreakpointsKey, body.Breakpoints)
+	// The response has one breakpoint for each requested, in order.
+	for i, bp := range body.Breakpoints {
+		if i < len(bps) {
+			reportBreakpoint(s, bp, bps[i].InstructionReference)
+		}
+	}
+	return nil
+}
+
+// listedBreakpoint is an entry in the breakpoints list.
+type listedBreakpoint struct {
+	// what describes the breakpoint as it was set.
+	what string
+	// condition and hitCondition are as they were set.
+	condition    string
+	hitCondition string
+	// key and index find the adapter's response for the breakpoint.
+	key   string
+	index int
+	// requestedLine is the line a source breakpoint was set on, in the
+	// adapter's numbering, or 0 for the others.
+	requestedLine int
+	// remove clears the breakpoint.
+	remove func(s *Session) error
+}
+
+// listBreakpoints returns every breakpoint the client knows about, source
+// breakpoints first, in the order they're numbered for clear.
+func listBreakpoints(s *Session) []listedBreakpoint {
+	var list []listedBreakpoint
+	sourceBps := s.getBreakpoints()
+	paths := make([]string, 0, len(sourceBps))
+	for path := range sourceBps {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		for i, bp := range sourceBps[path] {
+			path, line := path, displayLine(s, bp.Line)
+			list = append(list, listedBreakpoint{
+				what:          fmt.Sprintf("%s:%d", filepath.Base(path), line),
+				condition:     bp.Condition,
+				hitCondition:  bp.HitCondition,
+				key:           path,
+				index:         i,
+				requestedLine: bp.Line,
+				remove:        func(s *Session) error { return clearBreakpoint(s, path, line) },
+			})
+		}
+	}
+	for i, bp := range s.getFunctionBreakpoints() {
+		name := bp.Name
+		list = append(list, listedBreakpoint{
+			what:         "function " + name,
+			condition:    bp.Condition,
+			hitCondition: bp.HitCondition,
+			key:          functionBreakpointsKey,
+			index:        i,
+			remove: func(s *Session) error {
+				bps := s.removeFunctionBreakpoint(name)
+				fmt.Fprintf(s.opts.Out, "removed breakpoint at %s\n", name)
+				if !s.isConfigured() {
+					return nil
+				}
+				return setFunctionBreakpoints(s, bps)
+			},
+		})
+	}
+	for i, bp := range s.getDataBreakpoints() {
+		what := "data " + bp.DataID
+		if bp.AccessType != "" {
+			what += " (" + bp.AccessType + ")"
+		}
+		dataID := bp.DataID
+		list = append(list, listedBreakpoint{
+			what:         what,
+			condition:    bp.Condition,
+			hitCondition: bp.HitCondition,
+			key:          dataBreakpointsKey,
+			index:        i,
+			remove: func(s *Session) error {
+				fmt.Fprintf(s.opts.Out, "removed watch on %s\n", dataID)
+				return setDataBreakpoints(s, s.removeDataBreakpoint(dataID))
+			},
+		})
+	}
+	for i, bp := range s.getInstructionBreakpoints() {
+		what := "instruction " + bp.InstructionReference
+		if bp.Offset != 0 {
+			what += fmt.Sprintf("%+d", bp.Offset)
+		}
+		i, ref := i, bp.InstructionReference
+		list = append(list, listedBreakpoint{
+			what:         what,
+			condition:    bp.Condition,
+			hitCondition: bp.HitCondition,
+			key:          instructionBreakpointsKey,
+			index:        i,
+			remove: func(s *Session) error {
+				fmt.Fprintf(s.opts.Out, "removed breakpoint at %s\n", ref)
+				return setInstructionBreakpoints(s, s.removeInstructionBreakpoint(i))
+			},
+		})
+	}
+	return list
+}
+
+// status describes what the adapter last said about the breakpoint.
+func (bp listedBreakpoint) status(s *Session) string {
+	result, ok := s.breakpointResult(bp.key, bp.index)
+	switch {
+	case !ok && !s.isConfigured():
+		return "not yet set"
+	case !ok:
+		return "unknown"
+	case !result.Verified && result.Message != "":
+		return "unverified: " + result.Message
+	case !result.Verified:
+		return "unverified"
+	case bp.requestedLine != 0 && result.Line != 0 && result.Line != bp.requestedLine:
+		return fmt.Sprintf("verified, moved to line %d", displayLine(s, result.Line))
+	default:
+		return "verified"
+	}
+}
+
+// infoCommand is info break, for those used to gdb.
+func infoCommand(s *Session, args []string) error {
+	if len(args) == 0 || (args[0] != "break" && args[0] != "breakpoints") {
+		return errors.New("usage: info break")
+	}
+	return breakpointsCommand(s, args[1:])
+}
+
+func breakpointsCommand(s *Session, args []string) error {
+	list := listBreakpoints(s)
+	if len(list) == 0 {
+		fmt.Fprintln(s.opts.Out, "no breakpoints")
+		return nil
+	}
+	for i, bp := range list {
+		line := fmt.Sprintf("%d. %s [%s]", i+1, bp.what, bp.status(s))
+		if bp.hitCondition != "" {
+			line += " hit " + bp.hitCondition
+		}
+		if bp.condition != "" {
+			line += " if " + bp.condition
+		}
+		fmt.Fprintln(s.opts.Out, line)
+	}
+	return nil
+}
+
+// clearNumbered removes the nth breakpoint in the breakpoints list.
+func clearNumbered(s *Session, n int) error {
+	list := listBreakpoints(s)
+	if n < 1 || n > len(list) {
+		return fmt.Errorf("no breakpoint %d; run breakpoints to list them", n)
+	}
+	return list[n-1].remove(s)
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+)
+
+func TestParseBreakpointConditions(t *testing.T) {
+	tests := []struct {
+		in                      string
+		condition, hitCondition string
+	}{
+		{"", "", ""},
+		{"if x > 5", "x > 5", ""},
+		{"if  len(s) == 0 ", "len(s) == 0", ""},
+		{"hit>=3", "", ">=3"},
+		{"hit >= 3", "", ">=3"},
+		{"hit 10", "", "10"},
+		{"hit %2 if x > 5", "x > 5", "%2"},
+		{"hit>=3 if hits == 0", "hits == 0", ">=3"},
+	}
+	for _, tt := range tests {
+		condition, hitCondition, err := parseBreakpointConditions(tt.in)
+		if err != nil {
+			t.Errorf("%q: %s", tt.in, err)
+			continue
+		}
+		if condition != tt.condition || hitCondition != tt.hitCondition {
+			t.Errorf("%q: got condition %q, hit condition %q; want %q, %q", tt.in, condition, hitCondition, tt.condition, tt.hitCondition)
+		}
+	}
+}
+
+func TestParseBreakpointConditionsErrors(t *testing.T) {
+	for _, in := range []string{"if", "hit", "hit >=", "when x", "hit 3 x"} {
+		if _, _, err := parseBreakpointConditions(in); err == nil {
+			t.Errorf("%q: no error", in)
+		}
+	}
+}
+
+func TestUnsupportedConditionsDropped(t *testing.T) {
+	s := &Session{sessionState: newSessionState(), opts: newOptions()}
+	s.setCapabilities(Capabilities{SupportsHitConditionalBreakpoints: true})
+	condition, hitCondition := supportedConditions(s, "x > 5", ">=3")
+	if condition != "" || hitCondition != ">=3" {
+		t.Errorf("got condition %q, hit condition %q; want only the hit condition kept", condition, hitCondition)
+	}
+}
+
+func TestBreakpointEventVerifies(t *testing.T) {
+	s := &Session{sessionState: newSessionState(), opts: newOptions()}
+	out := captureOutput(s)
+	pending := Breakpoint{ID: 2, Line: 42}
+	s.setBreakpointResults("/src/main.go", []Breakpoint{{ID: 1, Verified: true, Line: 10}, pending})
+	s.setBreakpointStatus(pending, "main.go:42")
+
+	changed := Event{Event: "breakpoint", Body: json.RawMessage(`{"reason": "changed", "breakpoint": {"id": 2, "verified": true, "line": 42}}`)}
+	handleEvent(s, changed)
+	if want := "breakpoint at main.go:42 verified\n"; out.String() != want {
+		t.Errorf("printed %q, want %q", out.String(), want)
+	}
+	if bp, _ := s.breakpointResult("/src/main.go", 1); !bp.Verified {
+		t.Error("breakpoint not marked verified")
+	}
+
+	// Only the change to verified is worth mentioning.
+	out.Reset()
+	handleEvent(s, changed)
+	if out.Len() > 0 {
+		t.Errorf("printed %q for a breakpoint that was already verified", out.String())
+	}
+}
+
+func TestBreakpointsQueuedBeforeLaunch(t *testing.T) {
+	s, adapter := newFakeSession(t)
+	s.setCapabilities(Capabilities{SupportsConfigurationDoneRequest: true})
+	breakCommand(s, []string{"/src/main.go:10"})
+	breakCommand(s, []string{"/src/main.go:20"})
+	go adapter.sendEvent("initialized", nil)
+
+	reqs := adapter.readRequests(func(req fakeRequest) interface{} { return nil })
+	if got := commandsOf(reqs); fmt.Sprint(got) != "[setBreakpoints configurationDone]" {
+		t.Fatalf("sent %v, want one setBreakpoints and then configurationDone", got)
+	}
+	var args SetBreakpointsArgs
+	json.Unmarshal(reqs[0].Arguments, &args)
+	if args.Source.Path != "/src/main.go" || len(args.Breakpoints) != 2 ||
+		args.Breakpoints[0].Line != 10 || args.Breakpoints[1].Line != 20 {
+		t.Errorf("sent breakpoints %+v for %s, want lines 10 and 20 of /src/main.go", args.Breakpoints, args.Source.Path)
+	}
+}
+
+func TestClear(t *testing.T) {
+	tests := []struct {
+		args []string
+		// sent maps each file setBreakpoints is sent for to the lines
+		// sent, and left to the lines still set.
+		sent, left map[string][]int
+	}{
+		{[]string{"/src/a.go:10"}, map[string][]int{"/src/a.go": {20}}, map[string][]int{"/src/a.go": {20}, "/src/b.go": {5}}},
+		{[]string{"/src/a.go"}, map[string][]int{"/src/a.go": {}}, map[string][]int{"/src/b.go": {5}}},
+		{nil, map[string][]int{"/src/a.go": {}, "/src/b.go": {}}, map[string][]int{}},
+	}
+	for _, tt := range tests {
+		s, adapter := newFakeSession(t)
+		s.addBreakpoint("/src/a.go", SourceBreakpoint{Line: 10})
+		s.addBreakpoint("/src/a.go", SourceBreakpoint{Line: 20})
+		s.addBreakpoint("/src/b.go", SourceBreakpoint{Line: 5})
+		s.setConfigured()
+		reqs := make(chan fakeRequest, 10)
+		go adapter.serve(func(req fakeRequest) interface{} {
+			reqs <- req
+			return nil
+		})
+
+		clearCommand(s, tt.args)
+		sent := map[string][]int{}
+		for len(reqs) > 0 {
+			var args SetBreakpointsArgs
+			json.Unmarshal((<-reqs).Arguments, &args)
+			sent[args.Source.Path] = linesOf(args.Breakpoints)
+		}
+		if fmt.Sprint(sent) != fmt.Sprint(tt.sent) {
+			t.Errorf("clear %v sent %v, want %v", tt.args, sent, tt.sent)
+		}
+		left := map[string][]int{}
+		for path, bps := range s.getBreakpoints() {
+			left[path] = linesOf(bps)
+		}
+		if fmt.Sprint(left) != fmt.Sprint(tt.left) {
+			t.Errorf("clear %v left %v, want %v", tt.args, left, tt.left)
+		}
+	}
+}
+
+func linesOf(bps []SourceBreakpoint) []int {
+	lines := []int{}
+	for _, bp := range bps {
+		lines = append(lines, bp.Line)
+	}
+	return lines
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+)
+
+type CancelArgs struct {
+	RequestID  int64  `json:"requestId,omitempty"`
+	ProgressID string `json:"progressId,omitempty"`
+}
+
+func CancelRequest(args CancelArgs) Request {
+	return Request{
+		ProtocolMessage: NewRequest(),
+		Command:         "cancel",
+		Arguments:       args,
+	}
+}
+
+// cancelLatest stops waiting for the most recent request still awaiting a
+// response, and asks the adapter to abandon it if it can. It reports
+// whether there was a request to cancel.
+func cancelLatest(s *Session) bool {
+	pending := s.pending
+	seq, command, ok := pending.latest()
+	if !ok {
+		return false
+	}
+	if checkSupported(s, "cancel") == nil {
+		// The adapter still responds to the cancelled request, but nothing
+		// will be waiting for it by then.
+		go func() {
+			if _, err := sendAndWait(s, CancelRequest(CancelArgs{RequestID: seq})); err != nil {
+				printError(s, "%s", err)
+			}
+		}()
+	} else {
+		fmt.Fprintf(s.opts.Out, "\nadapter does not support cancel; no longer waiting for %s\n", command)
+	}
+	pending.cancel(seq)
+	return true
+}
+
+// interrupted returns a channel that is closed the next time Ctrl-C is
+// pressed.
+func (o *Options) interrupted() <-chan struct{} {
+	o.interruptMu.Lock()
+	defer o.interruptMu.Unlock()
+	return o.interrupts
+}
+
+// interrupt wakes up everything waiting on interrupted.
+func (o *Options) interrupt() {
+	o.interruptMu.Lock()
+	defer o.interruptMu.Unlock()
+	close(o.interrupts)
+	o.interrupts = make(chan struct{})
+}
+
+// handleInterrupts turns Ctrl-C into a cancel while a command is waiting on
+// the adapter, and otherwise interrupts whatever is waiting on the
+// debuggee. The line editor reads Ctrl-C itself, so this only sees it while
+// no line is being read.
+func handleInterrupts(s *Session) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt)
+	for range signals {
+		if !cancelLatest(s) {
+			fmt.Fprintln(s.opts.Out)
+			s.opts.interrupt()
+		}
+	}
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// requiredCapabilities maps requests to the capability an adapter must
+// advertise before they can be sent.
+var requiredCapabilities = map[string]func(Capabilities) bool{
+	"configurationDone":         func(c Capabilities) bool { return c.SupportsConfigurationDoneRequest },
+	"setFunctionBreakpoints":    func(c Capabilities) bool { return c.SupportsFunctionBreakpoints },
+	"stepBack":                  func(c Capabilities) bool { return c.SupportsStepBack },
+	"reverseContinue":           func(c Capabilities) bool { return c.SupportsStepBack },
+	"setVariable":               func(c Capabilities) bool { return c.SupportsSetVariable },
+	"restartFrame":              func(c Capabilities) bool { return c.SupportsRestartFrame },
+	"gotoTargets":               func(c Capabilities) bool { return c.SupportsGotoTargetsRequest },
+	"goto":                      func(c Capabilities) bool { return c.SupportsGotoTargetsRequest },
+	"stepInTargets":             func(c Capabilities) bool { return c.SupportsStepInTargetsRequest },
+	"completions":               func(c Capabilities) bool { return c.SupportsCompletionsRequest },
+	"modules":                   func(c Capabilities) bool { return c.SupportsModulesRequest },
+	"terminate":                 func(c Capabilities) bool { return c.SupportsTerminateRequest },
+	"cancel":                    func(c Capabilities) bool { return c.SupportsCancelRequest },
+	"dataBreakpointInfo":        func(c Capabilities) bool { return c.SupportsDataBreakpoints },
+	"setDataBreakpoints":        func(c Capabilities) bool { return c.SupportsDataBreakpoints },
+	"setInstructionBreakpoints": func(c Capabilities) bool { return c.SupportsInstructionBreakpoints },
+	"readMemory":                func(c Capabilities) bool { return c.SupportsReadMemoryRequest },
+	"writeMemory":               func(c Capabilities) bool { return c.SupportsWriteMemoryRequest },
+	"disassemble":               func(c Capabilities) bool { return c.SupportsDisassembleRequest },
+	"exceptionInfo":             func(c Capabilities) bool { return c.SupportsExceptionInfoRequest },
+	"breakpointLocations":       func(c Capabilities) bool { return c.SupportsBreakpointLocationsRequest },
+	"loadedSources":             func(c Capabilities) bool { return c.SupportsLoadedSourcesRequest },
+	"setExpression":             func(c Capabilities) bool { return c.SupportsSetExpression },
+	"restart":                   func(c Capabilities) bool { return c.SupportsRestartRequest },
+}
+
+// checkSupported returns an error if the adapter hasn't advertised support
+// for the request command.
+func checkSupported(s *Session, command string) error {
+	if s.opts.DryRun {
+		// Any request can be shown in a dry run.
+		return nil
+	}
+	supported, ok := requiredCapabilities[command]
+	if ok && !supported(s.getCapabilities()) {
+		return fmt.Errorf("adapter does not support %s", command)
+	}
+	return nil
+}
+
+// capabilityGroups are the capabilities caps shows, in the order it shows
+// them.
+var capabilityGroups = []struct {
+	name         string
+	capabilities []capability
+}{
+	{"breakpoints", []capability{
+		{"function breakpoints", func(c Capabilities) bool { return c.SupportsFunctionBreakpoints }},
+		{"conditional breakpoints", func(c Capabilities) bool { return c.SupportsConditionalBreakpoints }},
+		{"hit count breakpoints", func(c Capabilities) bool { return c.SupportsHitConditionalBreakpoints }},
+		{"data breakpoints (watch)", func(c Capabilities) bool { return c.SupportsDataBreakpoints }},
+		{"instruction breakpoints (ibreak)", func(c Capabilities) bool { return c.SupportsInstructionBreakpoints }},
+		{"breakpoint locations", func(c Capabilities) bool { return c.SupportsBreakpointLocationsRequest }},
+		{"exception filters (catch)", func(c Capabilities) bool { return len(c.ExceptionBreakpointFilters) > 0 }},
+	}},
+	{"stepping", []capability{
+		{"stepping back (back, rc)", func(c Capabilities) bool { return c.SupportsStepBack }},
+		{"restarting frames (restart-frame)", func(c Capabilities) bool { return c.SupportsRestartFrame }},
+		{"jumping to a line (goto)", func(c Capabilities) bool { return c.SupportsGotoTargetsRequest }},
+		{"step-in targets", func(c Capabilities) bool { return c.SupportsStepInTargetsRequest }},
+	}},
+	{"memory", []capability{
+		{"reading memory (x)", func(c Capabilities) bool { return c.SupportsReadMemoryRequest }},
+		{"writing memory (wmem)", func(c Capabilities) bool { return c.SupportsWriteMemoryRequest }},
+		{"disassembly (disas)", func(c Capabilities) bool { return c.SupportsDisassembleRequest }},
+	}},
+	{"misc", []capability{
+		{"setting variables (set)", func(c Capabilities) bool { return c.SupportsSetVariable }},
+		{"assigning expressions (assign)", func(c Capabilities) bool { return c.SupportsSetExpression }},
+		{"completions", func(c Capabilities) bool { return c.SupportsCompletionsRequest }},
+		{"value formatting (format)", func(c Capabilities) bool { return c.SupportsValueFormattingOptions }},
+		{"evaluating for hovers", func(c Capabilities) bool { return c.SupportsEvaluateForHovers }},
+		{"exception info (exception)", func(c Capabilities) bool { return c.SupportsExceptionInfoRequest }},
+		{"modules", func(c Capabilities) bool { return c.SupportsModulesRequest }},
+		{"loaded sources", func(c Capabilities) bool { return c.SupportsLoadedSourcesRequest }},
+		{"configurationDone", func(c Capabilities) bool { return c.SupportsConfigurationDoneRequest }},
+		{"terminate", func(c Capabilities) bool { return c.SupportsTerminateRequest }},
+		{"cancel", func(c Capabilities) bool { return c.SupportsCancelRequest }},
+		{"restart", func(c Capabilities) bool { return c.SupportsRestartRequest }},
+	}},
+}
+
+type capability struct {
+	description string
+	supported   func(Capabilities) bool
+}
+
+// capabilitiesSummary describes in one line how much of what caps lists the
+// adapter supports.
+func capabilitiesSummary(caps Capabilities) string {
+	var missing []string
+	total := 0
+	for _, group := range capabilityGroups {
+		for _, capability := range group.capabilities {
+			total++
+			if !capability.supported(caps) {
+				missing = append(missing, capability.description)
+			}
+		}
+	}
+	summary := fmt.Sprintf("adapter supports %d of %d features", total-len(missing), total)
+	if len(missing) > 0 {
+		summary += "; missing " + strings.Join(missing, ", ")
+	}
+	return summary + " (see caps)"
+}
+
+func capsCommand(s *Session, args []string) error {
+	caps := s.getCapabilities()
+	if len(args) > 0 && args[0] != "--raw" {
+		return errors.New("usage: caps [--raw]")
+	}
+	raw := len(args) > 0
+	if s.opts.JSON {
+		if raw {
+			printJSON(s, caps.Raw)
+		} else {
+			printJSON(s, caps)
+		}
+		return nil
+	}
+	if raw {
+		b, err := json.MarshalIndent(caps.Raw, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to encode capabilities: %s", err)
+		}
+		fmt.Fprintln(s.opts.Out, string(b))
+		return nil
+	}
+	for i, group := range capabilityGroups {
+		if i > 0 {
+			fmt.Fprintln(s.opts.Out)
+		}
+		fmt.Fprintln(s.opts.Out, group.name+":")
+		for _, capability := range group.capabilities {
+			if capability.supported(caps) {
+				fmt.Fprintln(s.opts.Out, "  "+colorize(colorGreen, "✓")+" "+capability.description)
+			} else {
+				fmt.Fprintln(s.opts.Out, "  "+colorize(colorRed, "✗")+" "+capability.description)
+			}
+		}
+	}
+	return nil
+}
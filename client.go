@@ -0,0 +1,366 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Client speaks the protocol over the connection to one debug adapter. It
+// numbers the requests it sends and matches the adapter's responses to them,
+// and hands events and reverse requests to the handler Listen is given.
+type Client struct {
+	io.ReadWriteCloser
+	// Timeout is how long SendAndWait waits for a response. In a dry run,
+	// DryRun is set and is given the requests instead of them being sent.
+	Timeout time.Duration
+	DryRun  func(req Request)
+	// seq is the seq of the last message sent, and pending holds the
+	// requests still waiting for a response.
+	seq     int64
+	pending *pendingRequests
+	// sendMu serializes writes so that concurrently sent messages don't
+	// interleave on the wire.
+	sendMu sync.Mutex
+}
+
+func NewClient(conn io.ReadWriteCloser) *Client {
+	return &Client{ReadWriteCloser: conn, Timeout: defaultRequestTimeout, pending: newPendingRequests()}
+}
+
+// defaultRequestTimeout is how long a client waits for each response unless
+// --timeout says otherwise.
+const defaultRequestTimeout = 10 * time.Second
+
+// pendingRequests tracks the requests that are awaiting a response, keyed by
+// their seq. It is safe for concurrent use.
+type pendingRequests struct {
+	mu       sync.Mutex
+	requests map[int64]pendingRequest
+	// closed is set once the connection has closed, after which no more
+	// responses will arrive.
+	closed bool
+}
+
+type pendingRequest struct {
+	command string
+	ch      chan Response
+}
+
+func newPendingRequests() *pendingRequests {
+	return &pendingRequests{requests: make(map[int64]pendingRequest)}
+}
+
+// register returns a channel that will receive the response to the request
+// with the given seq.
+func (p *pendingRequests) register(seq int64, command string) chan Response {
+	ch := make(chan Response, 1)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		close(ch)
+		return ch
+	}
+	p.requests[seq] = pendingRequest{command: command, ch: ch}
+	return ch
+}
+
+// deliver sends resp to the channel registered for seq, if any, and reports
+// whether one was found.
+func (p *pendingRequests) deliver(seq int64, resp Response) bool {
+	p.mu.Lock()
+	req, ok := p.requests[seq]
+	delete(p.requests, seq)
+	p.mu.Unlock()
+	if ok {
+		req.ch <- resp
+		close(req.ch)
+	}
+	return ok
+}
+
+// cancel stops waiting for the response to seq, closing its channel.
+func (p *pendingRequests) cancel(seq int64) {
+	p.mu.Lock()
+	req, ok := p.requests[seq]
+	delete(p.requests, seq)
+	p.mu.Unlock()
+	if ok {
+		close(req.ch)
+	}
+}
+
+// closeAll closes the channels of every request still awaiting a response,
+// and of any registered after, once the connection has closed.
+func (p *pendingRequests) closeAll() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.closed = true
+	for seq, req := range p.requests {
+		close(req.ch)
+		delete(p.requests, seq)
+	}
+}
+
+// isClosed reports whether closeAll has been called.
+func (p *pendingRequests) isClosed() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.closed
+}
+
+// latest returns the most recently sent request that is still awaiting a
+// response, not counting cancel requests.
+func (p *pendingRequests) latest() (seq int64, command string, ok bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for s, req := range p.requests {
+		if req.command != "cancel" && s > seq {
+			seq, command, ok = s, req.command, true
+		}
+	}
+	return seq, command, ok
+}
+
+// A messageHandler is given the messages from the adapter that aren't
+// responses.
+type messageHandler interface {
+	onEvent(event Event)
+	onRequest(req ReverseRequest)
+	// closing reports whether the connection is expected to close, in
+	// which case failing to read from it isn't an error.
+	closing() bool
+}
+
+// Listen reads messages from the adapter until the connection is closed,
+// delivering responses to the requests waiting for them and passing
+// everything else to h. It returns nil if the connection ended normally.
+func (cl *Client) Listen(h messageHandler) error {
+	// Nothing will answer requests once this returns, so don't leave them
+	// waiting for the timeout.
+	defer cl.pending.closeAll()
+	r := bufio.NewReader(cl)
+	for {
+		headers := make(map[string]string)
+		var preamble []byte
+		for {
+			// Technically we need to look for \r\n, but this should catch the \r too, we just need to trim it off.
+			data, err := r.ReadBytes('\n')
+			if err != nil {
+				if err == io.EOF || h.closing() {
+					return nil
+				}
+				return fmt.Errorf("failed to read line: %s", err)
+			}
+			line := string(bytes.TrimSpace(data))
+			if len(headers) == 0 && !isContentLength(line) {
+				// Some adapters print banners or logging on the same
+				// stream, so anything before a message's headers is
+				// skipped.
+				preamble = append(preamble, data...)
+				continue
+			}
+			if len(line) == 0 {
+				break
+			}
+			parts := strings.SplitN(line, ":", 2)
+			if len(parts) < 2 {
+				log.Printf("warning: skipping malformed header line: %q", line)
+				continue
+			}
+			// Header names are case-insensitive, so they're kept in
+			// lower case.
+			headers[strings.ToLower(strings.TrimSpace(parts[0]))] = strings.TrimSpace(parts[1])
+		}
+
+		if len(bytes.TrimSpace(preamble)) > 0 {
+			logTraffic("<-- (not a message, discarded)", preamble)
+		}
+
+		if headers["content-length"] == "" {
+			log.Printf("warning: no Content-Length header")
+			continue
+		}
+
+		// A bad length can't be trusted to find the end of the body, so
+		// the reader moves on to whatever header comes next.
+		contentLength, err := strconv.Atoi(headers["content-length"])
+		if err != nil {
+			log.Printf("skipping message with bad Content-Length: %s", err)
+			continue
+		}
+		if contentLength < 0 {
+			log.Printf("skipping message with negative Content-Length %d", contentLength)
+			continue
+		}
+
+		body := make([]byte, contentLength)
+		if _, err := io.ReadFull(r, body); err != nil {
+			if err == io.EOF || h.closing() {
+				return nil
+			}
+			return fmt.Errorf("failed to read body: %s", err)
+		}
+
+		logTraffic("<--", body)
+
+		// A bad message is skipped rather than ending the session, since
+		// the next one may well be fine.
+		var msg ProtocolMessage
+		if err := json.Unmarshal(body, &msg); err != nil {
+			log.Printf("skipping malformed message: %s\n%s", err, previewBody(body))
+			continue
+		}
+
+		switch msg.Type {
+		case "response":
+			var resp Response
+			if err := json.Unmarshal(body, &resp); err != nil {
+				log.Printf("skipping malformed response: %s\n%s", err, previewBody(body))
+				continue
+			}
+			// Responses can arrive in any order, and each is matched to
+			// its request by seq. Nothing is waiting for one that arrives
+			// after its request timed out or was cancelled.
+			if !cl.pending.deliver(resp.RequestSeq, resp) {
+				log.Printf("ignoring response to %s request %d, which is no longer pending", resp.Command, resp.RequestSeq)
+			}
+		case "event":
+			var event Event
+			if err := json.Unmarshal(body, &event); err != nil {
+				log.Printf("skipping malformed event: %s\n%s", err, previewBody(body))
+				continue
+			}
+			h.onEvent(event)
+		case "request":
+			var req ReverseRequest
+			if err := json.Unmarshal(body, &req); err != nil {
+				log.Printf("skipping malformed request: %s\n%s", err, previewBody(body))
+				continue
+			}
+			h.onRequest(req)
+		default:
+			log.Printf("warning: ignoring message of unknown type %q", msg.Type)
+		}
+	}
+}
+
+// isContentLength reports whether line is a Content-Length header, which
+// starts every message.
+func isContentLength(line string) bool {
+	return len(line) >= len("content-length:") && strings.EqualFold(line[:len("content-length:")], "content-length:")
+}
+
+// maxBodyPreview is how much of a malformed message is logged.
+const maxBodyPreview = 64
+
+// previewBody returns a hex dump of the start of a message body, for logging
+// messages that couldn't be read.
+func previewBody(body []byte) string {
+	if len(body) <= maxBodyPreview {
+		return hex.Dump(body)
+	}
+	return hex.Dump(body[:maxBodyPreview]) + fmt.Sprintf("(%d more bytes)", len(body)-maxBodyPreview)
+}
+
+// nextSeq returns the seq for the next message sent.
+func (cl *Client) nextSeq() int64 {
+	return atomic.AddInt64(&cl.seq, 1)
+}
+
+// sendRequest assigns req the next seq and sends it, returning the seq and
+// the channel its response will be delivered to. The seq is allocated under
+// sendMu so that seqs go out in increasing order.
+func (cl *Client) sendRequest(req Request) (int64, chan Response) {
+	cl.sendMu.Lock()
+	defer cl.sendMu.Unlock()
+	req.Seq = cl.nextSeq()
+	ch := cl.pending.register(req.Seq, req.Command)
+	cl.writeMessage(req)
+	return req.Seq, ch
+}
+
+// sendResponse answers a reverse request from the adapter.
+func (cl *Client) sendResponse(resp Response) {
+	cl.sendMu.Lock()
+	defer cl.sendMu.Unlock()
+	resp.Seq = cl.nextSeq()
+	cl.writeMessage(resp)
+}
+
+// writeMessage writes msg to the adapter. The caller must hold sendMu.
+func (cl *Client) writeMessage(msg interface{}) {
+	b, err := json.Marshal(msg)
+	if err != nil {
+		log.Printf("failed to send message: %s", err)
+		return
+	}
+	logTraffic("-->", b)
+	fmt.Fprintf(cl, "Content-Length: %d\r\n", len(b))
+	fmt.Fprint(cl, "\r\n")
+	cl.Write(b)
+}
+
+// SendAndWait sends req and waits for its response, giving up after
+// cl.Timeout. An unsuccessful response is returned as an error.
+func (cl *Client) SendAndWait(req Request) (Response, error) {
+	if err := validateRequest(req); err != nil {
+		return Response{}, err
+	}
+	if cl.DryRun != nil {
+		return cl.dryRunResponse(req), nil
+	}
+	seq, ch := cl.sendRequest(req)
+	select {
+	case resp, ok := <-ch:
+		if !ok && cl.pending.isClosed() {
+			return Response{}, fmt.Errorf("%s: connection closed before response", req.Command)
+		}
+		if !ok {
+			return Response{}, fmt.Errorf("%s: request cancelled", req.Command)
+		}
+		if !resp.Success {
+			return resp, fmt.Errorf("%s failed: %s", req.Command, resp.Message)
+		}
+		return resp, nil
+	case <-time.After(cl.Timeout):
+		cl.pending.cancel(seq)
+		return Response{}, fmt.Errorf("%s: no response after %s", req.Command, cl.Timeout)
+	}
+}
+
+// validateRequest catches requests that would go out as malformed messages,
+// such as one built without NewRequest.
+func validateRequest(req Request) error {
+	if req.Type != "request" {
+		return fmt.Errorf("%s: message type is %q, not \"request\"", req.Command, req.Type)
+	}
+	if req.Command == "" {
+		return errors.New("request has no command")
+	}
+	return nil
+}
+
+// Initialize sends the initialize request, and returns the capabilities the
+// adapter answers with.
+func (cl *Client) Initialize(args InitializeRequestArgs) (Capabilities, error) {
+	resp, err := cl.SendAndWait(InitializeRequest(args))
+	if err != nil {
+		return Capabilities{}, err
+	}
+	var caps Capabilities
+	if err := json.Unmarshal(resp.Body, &caps); err != nil {
+		return Capabilities{}, fmt.Errorf("failed to read capabilities: %s", err)
+	}
+	return caps, nil
+}
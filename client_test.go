@@ -0,0 +1,544 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeRequest is a request as the fake adapter reads it, with its arguments
+// left undecoded.
+type fakeRequest struct {
+	Seq       int64           `json:"seq"`
+	Type      string          `json:"type"`
+	Command   string          `json:"command"`
+	Arguments json.RawMessage `json:"arguments"`
+}
+
+// fakeAdapter is the other end of an in-memory connection to a Client. Tests
+// read what the client sends with readRequest, and answer with respond and
+// sendEvent.
+type fakeAdapter struct {
+	conn net.Conn
+	r    *bufio.Reader
+	// mu serializes writes, and seq is the seq of the last one.
+	mu  sync.Mutex
+	seq int64
+}
+
+// newFakeAdapter returns a Client connected to a fake adapter. Both ends are
+// closed when the test ends.
+func newFakeAdapter(t *testing.T) (*Client, *fakeAdapter) {
+	clientConn, adapterConn := net.Pipe()
+	t.Cleanup(func() {
+		clientConn.Close()
+		adapterConn.Close()
+	})
+	return NewClient(clientConn), &fakeAdapter{conn: adapterConn, r: bufio.NewReader(adapterConn)}
+}
+
+// readMessage reads the body of the next message the client sent.
+func (a *fakeAdapter) readMessage() ([]byte, error) {
+	length := -1
+	for {
+		line, err := a.r.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		line = strings.TrimSpace(line)
+		if line == "" {
+			break
+		}
+		if value := strings.TrimPrefix(line, "Content-Length: "); value != line {
+			if length, err = strconv.Atoi(value); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if length < 0 {
+		return nil, fmt.Errorf("no Content-Length header")
+	}
+	body := make([]byte, length)
+	_, err := io.ReadFull(a.r, body)
+	return body, err
+}
+
+// readRequest reads the next request the client sent.
+func (a *fakeAdapter) readRequest() (fakeRequest, error) {
+	var req fakeRequest
+	body, err := a.readMessage()
+	if err != nil {
+		return req, err
+	}
+	if err := json.Unmarshal(body, &req); err != nil {
+		return req, fmt.Errorf("bad request %s: %s", body, err)
+	}
+	return req, nil
+}
+
+// write sends msg to the client, setting its seq.
+func (a *fakeAdapter) write(msg map[string]interface{}) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.seq++
+	msg["seq"] = a.seq
+	b, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	return a.writeRaw([]byte(fmt.Sprintf("Content-Length: %d\r\n\r\n%s", len(b), b)))
+}
+
+// writeRaw sends data to the client as it is.
+func (a *fakeAdapter) writeRaw(data []byte) error {
+	_, err := a.conn.Write(data)
+	return err
+}
+
+// respond answers req successfully with body.
+func (a *fakeAdapter) respond(req fakeRequest, body interface{}) error {
+	return a.write(map[string]interface{}{
+		"type":        "response",
+		"request_seq": req.Seq,
+		"command":     req.Command,
+		"success":     true,
+		"body":        body,
+	})
+}
+
+// sendEvent sends the client an event.
+func (a *fakeAdapter) sendEvent(event string, body interface{}) error {
+	return a.write(map[string]interface{}{"type": "event", "event": event, "body": body})
+}
+
+// serve answers every request with handle's body until the connection
+// closes.
+func (a *fakeAdapter) serve(handle func(req fakeRequest) interface{}) {
+	for {
+		req, err := a.readRequest()
+		if err != nil {
+			return
+		}
+		if err := a.respond(req, handle(req)); err != nil {
+			return
+		}
+	}
+}
+
+// nopHandler ignores events and reverse requests.
+type nopHandler struct{}
+
+func (nopHandler) onEvent(event Event)          {}
+func (nopHandler) onRequest(req ReverseRequest) {}
+func (nopHandler) closing() bool                { return false }
+
+// listen runs cl.Listen until the test ends.
+func listen(t *testing.T, cl *Client, h messageHandler) {
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		cl.Listen(h)
+	}()
+	t.Cleanup(func() {
+		cl.Close()
+		<-done
+	})
+}
+
+func TestPendingRequestsConcurrent(t *testing.T) {
+	p := newPendingRequests()
+	var wg sync.WaitGroup
+	for i := int64(1); i <= 100; i++ {
+		seq := i
+		ch := p.register(seq, "evaluate")
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			if seq%3 == 0 {
+				p.cancel(seq)
+			} else {
+				p.deliver(seq, Response{RequestSeq: seq})
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			resp, ok := <-ch
+			if ok && resp.RequestSeq != seq {
+				t.Errorf("request %d got the response to %d", seq, resp.RequestSeq)
+			}
+			if ok == (seq%3 == 0) {
+				t.Errorf("request %d: got response %v, want cancelled %v", seq, ok, seq%3 == 0)
+			}
+		}()
+		go p.latest()
+	}
+	wg.Wait()
+	if _, _, ok := p.latest(); ok {
+		t.Error("requests still pending after every one was delivered or cancelled")
+	}
+}
+
+func TestSendAndWaitConcurrent(t *testing.T) {
+	cl, adapter := newFakeAdapter(t)
+	listen(t, cl, nopHandler{})
+	go adapter.serve(func(req fakeRequest) interface{} {
+		return map[string]interface{}{"result": string(req.Arguments)}
+	})
+
+	const requests = 50
+	var wg sync.WaitGroup
+	for i := 0; i < requests; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			expr := fmt.Sprintf("x%d", i)
+			resp, err := cl.SendAndWait(EvaluateRequest(EvaluateArgs{Expression: expr}))
+			if err != nil {
+				t.Errorf("%s: %s", expr, err)
+				return
+			}
+			var body struct{ Result string }
+			if err := json.Unmarshal(resp.Body, &body); err != nil {
+				t.Errorf("%s: %s", expr, err)
+				return
+			}
+			if !strings.Contains(body.Result, `"`+expr+`"`) {
+				t.Errorf("%s got the response %s", expr, body.Result)
+			}
+		}(i)
+	}
+	wg.Wait()
+}
+
+func TestResponsesOutOfOrder(t *testing.T) {
+	cl, adapter := newFakeAdapter(t)
+	listen(t, cl, nopHandler{})
+	// The adapter reads all three requests before answering any, and then
+	// answers them last first.
+	go func() {
+		var reqs []fakeRequest
+		for len(reqs) < 3 {
+			req, err := adapter.readRequest()
+			if err != nil {
+				return
+			}
+			reqs = append(reqs, req)
+		}
+		for i := len(reqs) - 1; i >= 0; i-- {
+			var args EvaluateArgs
+			json.Unmarshal(reqs[i].Arguments, &args)
+			adapter.respond(reqs[i], map[string]string{"result": args.Expression + " result"})
+		}
+	}()
+
+	exprs := []string{"a", "b", "c"}
+	results := make([]string, len(exprs))
+	var wg sync.WaitGroup
+	for i, expr := range exprs {
+		wg.Add(1)
+		go func(i int, expr string) {
+			defer wg.Done()
+			resp, err := cl.SendAndWait(EvaluateRequest(EvaluateArgs{Expression: expr}))
+			if err != nil {
+				t.Errorf("%s: %s", expr, err)
+				return
+			}
+			var body struct{ Result string }
+			json.Unmarshal(resp.Body, &body)
+			results[i] = body.Result
+		}(i, expr)
+	}
+	wg.Wait()
+	for i, expr := range exprs {
+		if want := expr + " result"; results[i] != want {
+			t.Errorf("%s got %q, want %q", expr, results[i], want)
+		}
+	}
+}
+
+func TestIndependentClients(t *testing.T) {
+	answering, answeringAdapter := newFakeAdapter(t)
+	silent, silentAdapter := newFakeAdapter(t)
+	listen(t, answering, nopHandler{})
+	listen(t, silent, nopHandler{})
+	silent.Timeout = 50 * time.Millisecond
+
+	seqs := make(chan int64, 2)
+	go answeringAdapter.serve(func(req fakeRequest) interface{} {
+		seqs <- req.Seq
+		return nil
+	})
+	go func() {
+		// Read the request but never answer it.
+		req, err := silentAdapter.readRequest()
+		if err == nil {
+			seqs <- req.Seq
+		}
+	}()
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		if _, err := answering.SendAndWait(ThreadsRequest()); err != nil {
+			t.Errorf("answered client: %s", err)
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		if _, err := silent.SendAndWait(ThreadsRequest()); err == nil {
+			t.Error("silent client got a response")
+		}
+	}()
+	wg.Wait()
+	// Each client numbers its own requests.
+	for i := 0; i < 2; i++ {
+		if seq := <-seqs; seq != 1 {
+			t.Errorf("got seq %d, want 1", seq)
+		}
+	}
+
+	// A dry run on one client doesn't touch the other.
+	silent.DryRun = func(req Request) {}
+	if _, err := silent.SendAndWait(ThreadsRequest()); err != nil {
+		t.Errorf("dry run: %s", err)
+	}
+	if answering.DryRun != nil || answering.Timeout != defaultRequestTimeout {
+		t.Errorf("settings leaked to the other client: DryRun %v, Timeout %s", answering.DryRun != nil, answering.Timeout)
+	}
+}
+
+// eventRecorder passes on the events it's given.
+type eventRecorder struct {
+	nopHandler
+	events chan Event
+}
+
+func newEventRecorder() eventRecorder {
+	return eventRecorder{events: make(chan Event, 10)}
+}
+
+func (r eventRecorder) onEvent(event Event) { r.events <- event }
+
+// next returns the next event, failing the test if none arrives.
+func (r eventRecorder) next(t *testing.T) Event {
+	t.Helper()
+	select {
+	case event := <-r.events:
+		return event
+	case <-time.After(time.Second):
+		t.Fatal("no event arrived")
+		return Event{}
+	}
+}
+
+func TestHeaderValuesWithColons(t *testing.T) {
+	cl, adapter := newFakeAdapter(t)
+	events := newEventRecorder()
+	listen(t, cl, events)
+
+	body := `{"seq":1,"type":"event","event":"stopped"}`
+	for _, header := range []string{
+		"Content-Type: application/vscode-jsonrpc; charset=utf-8",
+		"X-Sent-At: 12:34:56",
+	} {
+		go adapter.writeRaw([]byte(fmt.Sprintf("Content-Length: %d\r\n%s\r\n\r\n%s", len(body), header, body)))
+		if event := events.next(t); event.Event != "stopped" {
+			t.Errorf("%s: got event %q, want stopped", header, event.Event)
+		}
+	}
+}
+
+func TestHeaderLineWithoutColon(t *testing.T) {
+	cl, adapter := newFakeAdapter(t)
+	events := newEventRecorder()
+	listen(t, cl, events)
+
+	body := `{"seq":1,"type":"event","event":"stopped"}`
+	go adapter.writeRaw([]byte(fmt.Sprintf("Content-Length: %d\r\nnot a header\r\n\r\n%s", len(body), body)))
+	if event := events.next(t); event.Event != "stopped" {
+		t.Errorf("got event %q, want stopped", event.Event)
+	}
+}
+
+// pipeConn is a connection made of two pipes, standing in for a transport
+// that isn't a net.Conn, like an adapter's stdin and stdout.
+type pipeConn struct {
+	io.Reader
+	io.WriteCloser
+}
+
+func TestClientOverPipes(t *testing.T) {
+	toClient, fromAdapter := io.Pipe()
+	fromClient, toAdapter := io.Pipe()
+	cl := NewClient(pipeConn{toClient, toAdapter})
+	listen(t, cl, nopHandler{})
+	t.Cleanup(func() { fromAdapter.Close() })
+
+	adapter := &fakeAdapter{r: bufio.NewReader(fromClient)}
+	go func() {
+		req, err := adapter.readRequest()
+		if err != nil {
+			return
+		}
+		b, _ := json.Marshal(map[string]interface{}{
+			"seq": 1, "type": "response", "request_seq": req.Seq, "command": req.Command, "success": true,
+		})
+		fmt.Fprintf(fromAdapter, "Content-Length: %d\r\n\r\n%s", len(b), b)
+	}()
+	if _, err := cl.SendAndWait(ThreadsRequest()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSendAndWaitFailure(t *testing.T) {
+	cl, adapter := newFakeAdapter(t)
+	listen(t, cl, nopHandler{})
+	go func() {
+		req, err := adapter.readRequest()
+		if err != nil {
+			return
+		}
+		adapter.write(map[string]interface{}{
+			"type":        "response",
+			"request_seq": req.Seq,
+			"command":     req.Command,
+			"success":     false,
+			"message":     "no such thread",
+		})
+	}()
+	_, err := cl.SendAndWait(ThreadsRequest())
+	if err == nil || err.Error() != "threads failed: no such thread" {
+		t.Errorf("got error %v, want the adapter's message", err)
+	}
+}
+
+func TestSendAndWaitTimeout(t *testing.T) {
+	cl, adapter := newFakeAdapter(t)
+	listen(t, cl, nopHandler{})
+	cl.Timeout = 50 * time.Millisecond
+	go adapter.readRequest()
+	if _, err := cl.SendAndWait(ThreadsRequest()); err == nil {
+		t.Fatal("got a response from an adapter that doesn't answer")
+	}
+	if _, _, ok := cl.pending.latest(); ok {
+		t.Error("timed out request still pending")
+	}
+}
+
+func TestSeqsAssignedWhenSent(t *testing.T) {
+	cl, adapter := newFakeAdapter(t)
+	listen(t, cl, nopHandler{})
+	var seqs []int64
+	go adapter.serve(func(req fakeRequest) interface{} {
+		seqs = append(seqs, req.Seq)
+		return nil
+	})
+
+	// Built in one order and sent in another.
+	reqs := []Request{ThreadsRequest(), EvaluateRequest(EvaluateArgs{Expression: "x"}), ThreadsRequest()}
+	for i := len(reqs) - 1; i >= 0; i-- {
+		if _, err := cl.SendAndWait(reqs[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(seqs) != len(reqs) {
+		t.Fatalf("adapter read %d requests, want %d", len(seqs), len(reqs))
+	}
+	for i, seq := range seqs {
+		if want := int64(i + 1); seq != want {
+			t.Errorf("request %d went out with seq %d, want %d", i, seq, want)
+		}
+	}
+}
+
+func TestNonRequestRejected(t *testing.T) {
+	cl, adapter := newFakeAdapter(t)
+	listen(t, cl, nopHandler{})
+	req := Request{ProtocolMessage: ProtocolMessage{Type: "reqeust"}, Command: "threads"}
+	if _, err := cl.SendAndWait(req); err == nil {
+		t.Fatal("sent a message that isn't a request")
+	}
+	adapter.conn.SetReadDeadline(time.Now().Add(50 * time.Millisecond))
+	if body, err := adapter.readMessage(); err == nil {
+		t.Errorf("adapter was sent %s", body)
+	}
+}
+
+func TestAdapterClosesDuringInitialize(t *testing.T) {
+	cl, adapter := newFakeAdapter(t)
+	listen(t, cl, nopHandler{})
+	go func() {
+		adapter.readRequest()
+		adapter.conn.Close()
+	}()
+	_, err := cl.Initialize(newOptions().InitializeArgs)
+	if err == nil || !strings.Contains(err.Error(), "connection closed before response") {
+		t.Errorf("got error %v, want the connection closed before the response", err)
+	}
+}
+
+// frame returns body with the header that goes before it.
+func frame(body string) string {
+	return fmt.Sprintf("Content-Length: %d\r\n\r\n%s", len(body), body)
+}
+
+func TestMalformedMessageSkipped(t *testing.T) {
+	cl, adapter := newFakeAdapter(t)
+	events := newEventRecorder()
+	listen(t, cl, events)
+
+	go adapter.writeRaw([]byte(frame(`{"seq":1,"type":"event","event":"first"}`) +
+		frame(`{"seq":2,"type":"event","event":`) +
+		frame(`{"seq":3,"type":"event","event":"third"}`)))
+	for _, want := range []string{"first", "third"} {
+		if event := events.next(t); event.Event != want {
+			t.Errorf("got event %q, want %q", event.Event, want)
+		}
+	}
+}
+
+func TestPreambleSkipped(t *testing.T) {
+	cl, adapter := newFakeAdapter(t)
+	events := newEventRecorder()
+	listen(t, cl, events)
+
+	go adapter.writeRaw([]byte("Starting debug adapter v1.2\r\nListening on stdio: ready\r\n" +
+		frame(`{"seq":1,"type":"event","event":"initialized"}`)))
+	if event := events.next(t); event.Event != "initialized" {
+		t.Errorf("got event %q, want initialized", event.Event)
+	}
+}
+
+func TestLowerCaseContentLength(t *testing.T) {
+	cl, adapter := newFakeAdapter(t)
+	events := newEventRecorder()
+	listen(t, cl, events)
+
+	body := `{"seq":1,"type":"event","event":"initialized"}`
+	go adapter.writeRaw([]byte(fmt.Sprintf("content-length: %d\r\n\r\n%s", len(body), body)))
+	if event := events.next(t); event.Event != "initialized" {
+		t.Errorf("got event %q, want initialized", event.Event)
+	}
+}
+
+func TestBadContentLengthSkipped(t *testing.T) {
+	for _, length := range []string{"ten", "-5"} {
+		cl, adapter := newFakeAdapter(t)
+		events := newEventRecorder()
+		listen(t, cl, events)
+
+		go adapter.writeRaw([]byte("Content-Length: " + length + "\r\n\r\n" +
+			frame(`{"seq":1,"type":"event","event":"initialized"}`)))
+		if event := events.next(t); event.Event != "initialized" {
+			t.Errorf("Content-Length %s: got event %q, want initialized", length, event.Event)
+		}
+	}
+}
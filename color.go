@@ -0,0 +1,58 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"golang.org/x/term"
+)
+
+// ANSI escape sequences used by colorize.
+const (
+	colorReset   = "\x1b[0m"
+	colorRed     = "\x1b[31m"
+	colorBoldRed = "\x1b[1;31m"
+	colorGreen   = "\x1b[32m"
+	colorCyan    = "\x1b[36m"
+)
+
+// useColor controls whether colorize does anything.
+var useColor = false
+
+// setColorMode sets useColor from the value of the --color option, which
+// is one of "auto", "always", or "never". In auto mode color is only used
+// when stdout is a terminal.
+func setColorMode(mode string) error {
+	switch mode {
+	case "auto":
+		useColor = isTerminal(os.Stdout)
+	case "always":
+		useColor = true
+	case "never":
+		useColor = false
+	default:
+		return fmt.Errorf("unknown color mode %q: expected auto, always, or never", mode)
+	}
+	return nil
+}
+
+func isTerminal(f *os.File) bool {
+	return term.IsTerminal(int(f.Fd()))
+}
+
+// colorize wraps s in the given color, if color is enabled.
+func colorize(color, s string) string {
+	if !useColor {
+		return s
+	}
+	return color + s + colorReset
+}
+
+// printError prints an error message for the user.
+func printError(s *Session, format string, args ...interface{}) {
+	if s.opts.JSON {
+		printJSON(s, CommandResult{Error: fmt.Sprintf(format, args...)})
+		return
+	}
+	fmt.Fprintln(s.opts.Out, colorize(colorBoldRed, fmt.Sprintf(format, args...)))
+}
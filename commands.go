@@ -0,0 +1,386 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// command is one of the REPL's commands.
+type command struct {
+	name    string
+	aliases []string
+	// args describes the command's arguments, as shown in its usage.
+	args string
+	// summary is the one line help shows in the list of commands, and
+	// details is what help <command> adds to it, examples included.
+	summary string
+	details string
+	// needsDebugging is set for the commands that set breakpoints, which
+	// are refused when running without debugging since nothing would ever
+	// stop at them.
+	needsDebugging bool
+	// rawArgs is set for the commands that take expressions or JSON,
+	// whose quotes belong to what's typed. Their arguments are only split
+	// on spaces.
+	rawArgs bool
+	// repeatable is set for the commands an empty line runs again, which
+	// are those it's safe to run over and over.
+	repeatable bool
+	// run runs the command. The error it returns is reported to the user,
+	// and fails the script the command is in.
+	run func(s *Session, args []string) error
+}
+
+// commands holds the REPL's commands, keyed by name and by alias. It is
+// filled in by init, since help refers to it.
+var commands map[string]*command
+
+func init() {
+	commands = make(map[string]*command)
+	for _, cmd := range []*command{
+		// Sessions
+		{name: "launch", args: "<program> [args...] | <configuration> [args...]", summary: "launch a program to debug", run: launch,
+			details: "Launches the program with the given arguments, or as the named\nconfiguration in the config file says.\n\nexamples:\n  launch ./server -port 8080\n  launch tests"},
+		{name: "attach", args: "pid=<pid> | host=<host> port=<port> [key=value...] | <configuration>", summary: "attach to a running program", run: attach,
+			details: "Other key=value pairs are passed to the adapter as attach arguments.\n\nexamples:\n  attach pid=4242\n  attach host=localhost port=2345"},
+		{name: "restart", summary: "restart the debuggee", run: restartCommand,
+			details: "Uses the adapter's restart request if it has one, and otherwise\nterminates the debuggee and launches it again."},
+		{name: "disconnect", summary: "disconnect from the adapter", run: disconnect,
+			details: "A launched debuggee is terminated; an attached one keeps running."},
+		{name: "terminate", summary: "terminate the debuggee and disconnect", run: terminate},
+		{name: "quit", aliases: []string{"q"}, summary: "end the session and exit", run: quit,
+			details: "Terminates a launched debuggee, or disconnects from an attached one."},
+		{name: "session", args: "[list | switch <id>]", summary: "list or switch between sessions", run: sessionCommand},
+		{name: "caps", args: "[--raw]", summary: "show what the adapter supports", run: capsCommand,
+			details: "--raw shows the capabilities as the adapter reported them."},
+		{name: "raw", args: "<command> [json-args]", summary: "send a request as given", rawArgs: true, run: rawCommand,
+			details: "examples:\n  raw threads\n  raw evaluate {\"expression\": \"x\", \"context\": \"repl\"}"},
+		{name: "cancel", args: "<progress id>", summary: "cancel a long-running operation", run: cancelCommand},
+
+		// Breakpoints
+		{name: "break", aliases: []string{"b"}, args: "<file>:<line> [hit <op><count>] [if <condition>]", summary: "set a breakpoint on a line", needsDebugging: true, rawArgs: true, run: breakCommand,
+			details: "Setting a breakpoint where there already is one replaces it.\n\nexamples:\n  break main.go:42\n  break main.go:42 if i > 10\n  break main.go:42 hit >=3"},
+		{name: "fbreak", args: "<function>", summary: "set a breakpoint on a function", needsDebugging: true, run: fbreakCommand},
+		{name: "ibreak", args: "<address> [hit <op><count>] [if <condition>]", summary: "set a breakpoint on an instruction", needsDebugging: true, rawArgs: true, run: ibreakCommand},
+		{name: "watch", args: "<ref> <name> [read|write|readWrite]", summary: "break when a variable is accessed", needsDebugging: true, run: watchCommand,
+			details: "ref is the variables reference of the scope or variable that holds\nname, as shown by vars. Access defaults to write.\n\nexamples:\n  watch 1000 count\n  watch 1000 count readWrite"},
+		{name: "catch", args: "[filter]", summary: "list or toggle exception breakpoints", needsDebugging: true, run: catchCommand},
+		{name: "blocs", args: "<file> <line> [end-line]", summary: "list where breakpoints can go", run: blocsCommand},
+		{name: "breakpoints", summary: "list breakpoints", run: breakpointsCommand},
+		{name: "info", args: "break", summary: "list breakpoints", run: infoCommand},
+		{name: "clear", args: "[<n> | <file>[:<line>]]", summary: "remove breakpoints", run: clearCommand,
+			details: "With no arguments, removes every line breakpoint. n is a number from\nthe breakpoints list.\n\nexamples:\n  clear 2\n  clear main.go\n  clear main.go:42"},
+
+		// Execution
+		{name: "continue", aliases: []string{"c"}, summary: "resume the current thread", repeatable: true, run: continueCommand},
+		{name: "until", args: "<file>:<line>", summary: "continue to a line", needsDebugging: true, run: untilCommand,
+			details: "Sets a temporary breakpoint on the line, which is removed once the\nthread stops, whether there or somewhere else."},
+		{name: "next", aliases: []string{"n"}, args: "[statement|line|instruction]", summary: "step over", repeatable: true, run: nextCommand},
+		{name: "step", aliases: []string{"s"}, args: "[choose] [statement|line|instruction]", summary: "step into", repeatable: true, run: stepInCommand,
+			details: "choose asks which call on the line to step into. Code matching the\nskip patterns is stepped back out of."},
+		{name: "stepout", aliases: []string{"so"}, args: "[statement|line|instruction]", summary: "step out of the current function", repeatable: true, run: stepOutCommand},
+		{name: "finish", args: "[statement|line|instruction]", summary: "step out and show the return value", repeatable: true, run: finishCommand},
+		{name: "skip", args: "[list | add <glob> | del <n>]", summary: "manage the paths step skips", run: skipCommand,
+			details: "examples:\n  skip add /usr/local/go/src/*\n  skip add *_gen.go\n  skip del 1"},
+		{name: "back", args: "[statement|line|instruction]", summary: "step backwards", repeatable: true, run: stepBackCommand},
+		{name: "rc", summary: "continue backwards", repeatable: true, run: reverseContinueCommand},
+		{name: "goto", args: "<file>:<line>", summary: "jump to a line without running the code between", run: gotoCommand},
+		{name: "pause", summary: "pause the debuggee", run: pauseCommand},
+		{name: "wait", args: "stopped|terminated [timeout]", summary: "wait for the debuggee to stop or terminate", run: waitCommand,
+			details: "Returns right away if it already has since it last ran. Scripts use\nthis after continue; it fails after the timeout (default 30s), which\n--stop-on-error stops the script on.\n\nexamples:\n  wait stopped\n  wait terminated 2m"},
+
+		// Stack and threads
+		{name: "backtrace", aliases: []string{"bt"}, args: "[n]", summary: "show the current thread's stack", run: backtraceCommand},
+		{name: "frame", aliases: []string{"f"}, args: "<n>", summary: "select a stack frame", run: frameCommand},
+		{name: "restart-frame", args: "<n>", summary: "restart execution of a stack frame", run: restartFrameCommand},
+		{name: "threads", summary: "list threads", run: threadsCommand},
+		{name: "thread", args: "<id>", summary: "select a thread", run: threadCommand},
+		{name: "exception", summary: "show the exception a thread stopped on", run: exceptionCommand},
+
+		// Source
+		{name: "list", aliases: []string{"l"}, args: "[n]", summary: "show source around the current line", repeatable: true, run: listCommand,
+			details: "Shows n lines either side of the current line (default 5)."},
+		{name: "sources", summary: "list loaded sources", run: sourcesCommand},
+		{name: "modules", summary: "list loaded modules", run: modulesCommand},
+
+		// Data
+		{name: "vars", args: "[<ref> page <n>]", summary: "show the current frame's variables", run: varsCommand,
+			details: "Large arrays are shown a page at a time.\n\nexamples:\n  vars\n  vars 1003 page 2"},
+		{name: "locals", summary: "show local variables", run: localsCommand},
+		{name: "args", summary: "show the current function's arguments", run: argsCommand},
+		{name: "expand", args: "<ref>", summary: "show the children of a variable", run: expandCommand},
+		{name: "tree", args: "<ref> [depth]", summary: "show a variable and its children as a tree", run: treeCommand},
+		{name: "eval", aliases: []string{"p"}, args: "<expression>", summary: "evaluate an expression", rawArgs: true, run: evalCommand,
+			details: "examples:\n  eval len(items)\n  p user.Name"},
+		{name: "set", args: "<ref> <name> = <value> | repeat on|off", summary: "change a variable or a setting", rawArgs: true, run: setCommand,
+			details: "set repeat off stops an empty line from repeating the last stepping\nor list command.\n\nexamples:\n  set 1000 count = 3\n  set repeat off"},
+		{name: "assign", args: "<expression> = <value>", summary: "assign to an expression", rawArgs: true, run: assignCommand,
+			details: "examples:\n  assign user.Name = \"bob\""},
+		{name: "format", args: "hex on|off", summary: "show values in hex", run: formatCommand},
+		{name: "watch-add", args: "<expr>", summary: "show an expression every time a thread stops", rawArgs: true, run: watchAddCommand},
+		{name: "watch-list", summary: "list watch expressions", run: watchListCommand},
+		{name: "watch-del", args: "<n>", summary: "remove a watch expression", run: watchDelCommand},
+
+		// Memory
+		{name: "x", args: "<memory reference> <count>", summary: "read memory", run: readMemoryCommand},
+		{name: "wmem", args: "<memory reference> <hex bytes>", summary: "write memory", run: writeMemoryCommand},
+		{name: "disas", args: "[n]", summary: "disassemble around the current instruction", run: disassembleCommand},
+
+		{name: "help", args: "[command]", summary: "list commands, or show how to use one", run: helpCommand},
+	} {
+		// help starts a sentence with the summary.
+		if cmd.summary == "" {
+			panic("command " + cmd.name + " has no summary")
+		}
+		commands[cmd.name] = cmd
+		for _, alias := range cmd.aliases {
+			commands[alias] = cmd
+		}
+	}
+}
+
+// handleCommand runs the command on line, reporting the error it fails
+// with, if any. Arguments are split as a shell would, so quotes keep spaces
+// in them, except for commands with rawArgs.
+func handleCommand(s *Session, line string) error {
+	line = strings.TrimSpace(line)
+	if line == "" {
+		return nil
+	}
+	name, rest := line, ""
+	if i := strings.IndexAny(line, " \t"); i >= 0 {
+		name, rest = line[:i], line[i:]
+	}
+	cmd, ok := commands[name]
+	if !ok {
+		err := errors.New(unknownCommand(name))
+		printError(s, "%s", err)
+		return err
+	}
+	args := strings.Fields(rest)
+	var err error
+	if !cmd.rawArgs {
+		args, err = splitArgs(rest)
+		if err != nil {
+			err = fmt.Errorf("%s: %s", name, err)
+		}
+	}
+	if err == nil {
+		err = runCommand(s, cmd, args)
+	}
+	if err != nil {
+		commandError(s, cmd.name, err)
+	}
+	return err
+}
+
+// repeatCommand returns the line to run in place of an empty one, which is
+// the last command if it's repeatable, or "" to do nothing.
+func repeatCommand(s *Session) string {
+	if !s.opts.RepeatLast {
+		return ""
+	}
+	return s.getLastCommand()
+}
+
+// rememberCommand records line as the one an empty line repeats, or forgets
+// the last one if line's command isn't repeatable.
+func rememberCommand(s *Session, line string) {
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return
+	}
+	if cmd, ok := commands[fields[0]]; ok && cmd.repeatable {
+		s.setLastCommand(line)
+	} else {
+		s.setLastCommand("")
+	}
+}
+
+func setRepeatCommand(s *Session, args []string) error {
+	if len(args) != 1 || (args[0] != "on" && args[0] != "off") {
+		return errors.New("usage: set repeat on|off")
+	}
+	s.opts.RepeatLast = args[0] == "on"
+	return nil
+}
+
+// splitArgs splits s into arguments at spaces. Single quotes keep what's
+// between them as it is, and double quotes do too except that a backslash
+// escapes a double quote or another backslash. Elsewhere a backslash
+// escapes any character.
+func splitArgs(s string) ([]string, error) {
+	var args []string
+	var arg strings.Builder
+	// inArg is set once something has been added to arg, since "" is an
+	// argument even though it's empty.
+	inArg := false
+	for i := 0; i < len(s); i++ {
+		switch ch := s[i]; {
+		case ch == ' ' || ch == '\t':
+			if inArg {
+				args = append(args, arg.String())
+				arg.Reset()
+				inArg = false
+			}
+		case ch == '\\':
+			if i+1 == len(s) {
+				return nil, errors.New("backslash at end of line")
+			}
+			i++
+			arg.WriteByte(s[i])
+			inArg = true
+		case ch == '\'':
+			end := strings.IndexByte(s[i+1:], '\'')
+			if end < 0 {
+				return nil, errors.New("unterminated ' quote")
+			}
+			arg.WriteString(s[i+1 : i+1+end])
+			i += end + 1
+			inArg = true
+		case ch == '"':
+			i++
+			for ; i < len(s) && s[i] != '"'; i++ {
+				if s[i] == '\\' && i+1 < len(s) && (s[i+1] == '"' || s[i+1] == '\\') {
+					i++
+				}
+				arg.WriteByte(s[i])
+			}
+			if i == len(s) {
+				return nil, errors.New("unterminated \" quote")
+			}
+			inArg = true
+		default:
+			arg.WriteByte(ch)
+			inArg = true
+		}
+	}
+	if inArg {
+		args = append(args, arg.String())
+	}
+	return args, nil
+}
+
+// runCommand runs cmd with args, which have already been split from the
+// line the user typed.
+func runCommand(s *Session, cmd *command, args []string) error {
+	if cmd.needsDebugging && isNoDebug(s) {
+		return fmt.Errorf("%s: breakpoints have no effect when running without debugging", cmd.name)
+	}
+	return cmd.run(s, args)
+}
+
+// usage returns how the command is used, as in "break <file>:<line>".
+func (cmd *command) usage() string {
+	if cmd.args == "" {
+		return cmd.name
+	}
+	return cmd.name + " " + cmd.args
+}
+
+// commandList returns each command once, in order of name.
+func commandList() []*command {
+	var list []*command
+	for name, cmd := range commands {
+		if name == cmd.name {
+			list = append(list, cmd)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].name < list[j].name })
+	return list
+}
+
+func helpCommand(s *Session, args []string) error {
+	if len(args) > 1 {
+		return errors.New("usage: help [command]")
+	}
+	if len(args) == 1 {
+		cmd, ok := commands[args[0]]
+		if !ok {
+			return fmt.Errorf("%s", unknownCommand(args[0]))
+		}
+		fmt.Fprintln(s.opts.Out, "usage: "+cmd.usage())
+		if len(cmd.aliases) > 0 {
+			fmt.Fprintln(s.opts.Out, "aliases: "+strings.Join(cmd.aliases, ", "))
+		}
+		fmt.Fprintln(s.opts.Out)
+		fmt.Fprintln(s.opts.Out, strings.ToUpper(cmd.summary[:1])+cmd.summary[1:]+".")
+		if cmd.details != "" {
+			fmt.Fprintln(s.opts.Out, cmd.details)
+		}
+		return nil
+	}
+	list := commandList()
+	width := 0
+	for _, cmd := range list {
+		if n := len(commandNamesOf(cmd)); n > width {
+			width = n
+		}
+	}
+	for _, cmd := range list {
+		fmt.Fprintf(s.opts.Out, "  %-*s  %s\n", width, commandNamesOf(cmd), cmd.summary)
+	}
+	fmt.Fprintln(s.opts.Out, "\nRun help <command> for more about one.")
+	return nil
+}
+
+// commandNamesOf returns the command's name followed by its aliases, as in
+// "break, b".
+func commandNamesOf(cmd *command) string {
+	return strings.Join(append([]string{cmd.name}, cmd.aliases...), ", ")
+}
+
+// unknownCommand describes a command that doesn't exist, suggesting the one
+// that was probably meant.
+func unknownCommand(name string) string {
+	best, bestDistance := "", 3
+	for other, cmd := range commands {
+		d := editDistance(name, other)
+		if other != cmd.name {
+			// Names are clearer suggestions than aliases just as close.
+			d++
+		}
+		if d < bestDistance || (d == bestDistance && len(commonPrefix([]string{name, other})) > len(commonPrefix([]string{name, best}))) {
+			best, bestDistance = other, d
+		}
+	}
+	// A suggestion that differs from a short name in most of its letters
+	// isn't much of a suggestion.
+	if best == "" || bestDistance >= len(name) {
+		return "unknown command: " + name
+	}
+	return fmt.Sprintf("unknown command: %s (did you mean %s?)", name, best)
+}
+
+// editDistance returns the Levenshtein distance between a and b.
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur := make([]int, len(b)+1)
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = minInt(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev = cur
+	}
+	return prev[len(b)]
+}
+
+func minInt(values ...int) int {
+	min := values[0]
+	for _, v := range values[1:] {
+		if v < min {
+			min = v
+		}
+	}
+	return min
+}
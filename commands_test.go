@@ -0,0 +1,72 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+)
+
+func TestDispatchContinue(t *testing.T) {
+	for _, line := range []string{"continue", "c"} {
+		s, adapter := newFakeSession(t)
+		s.setLaunched(LaunchRequestArgs{Program: "./prog"})
+		s.setStopped(4)
+		reqs := make(chan fakeRequest, 1)
+		go adapter.serve(func(req fakeRequest) interface{} {
+			reqs <- req
+			return nil
+		})
+
+		handleCommand(s, line)
+		req := <-reqs
+		var args ContinueArgs
+		json.Unmarshal(req.Arguments, &args)
+		if req.Command != "continue" || args.ThreadID != 4 {
+			t.Errorf("%s sent %s for thread %d, want continue for thread 4", line, req.Command, args.ThreadID)
+		}
+		if _, stopped := s.getCurrentThread(); stopped {
+			t.Errorf("%s left the thread marked stopped", line)
+		}
+	}
+}
+
+func TestSplitArgs(t *testing.T) {
+	tests := []struct {
+		in   string
+		want []string
+	}{
+		{"", nil},
+		{"  a  b\tc ", []string{"a", "b", "c"}},
+		{`"foo bar" baz`, []string{"foo bar", "baz"}},
+		{`'a b c'`, []string{"a b c"}},
+		{`""`, []string{""}},
+		{`"say \"hi\""`, []string{`say "hi"`}},
+		{`'it\s'`, []string{`it\s`}},
+		{`a\ b`, []string{"a b"}},
+		{`x="1 2"y`, []string{"x=1 2y"}},
+	}
+	for _, tt := range tests {
+		got, err := splitArgs(tt.in)
+		if err != nil {
+			t.Errorf("%q: %s", tt.in, err)
+			continue
+		}
+		if fmt.Sprintf("%q", got) != fmt.Sprintf("%q", tt.want) {
+			t.Errorf("%q: got %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestSplitArgsErrors(t *testing.T) {
+	for in, want := range map[string]string{
+		`"foo bar`: `unterminated " quote`,
+		`'foo`:     "unterminated ' quote",
+		`foo\`:     "backslash at end of line",
+		`"a \" b`:  `unterminated " quote`,
+	} {
+		_, err := splitArgs(in)
+		if err == nil || err.Error() != want {
+			t.Errorf("%q: got error %v, want %q", in, err, want)
+		}
+	}
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+type CompletionsArgs struct {
+	Text    string `json:"text"`
+	Column  int    `json:"column"`
+	FrameID int    `json:"frameId,omitempty"`
+}
+
+type CompletionItem struct {
+	Label string `json:"label"`
+	Text  string `json:"text"`
+	Type  string `json:"type"`
+	// Start and Length give the range of the request text that the item
+	// replaces. If Start is omitted, the item is inserted at the column.
+	Start  *int `json:"start"`
+	Length int  `json:"length"`
+}
+
+type CompletionsResponseBody struct {
+	Targets []CompletionItem `json:"targets"`
+}
+
+func CompletionsRequest(args CompletionsArgs) Request {
+	return Request{
+		ProtocolMessage: NewRequest(),
+		Command:         "completions",
+		Arguments:       args,
+	}
+}
+
+// completer returns a function that completes the REPL line up to pos. It
+// returns the index in line from which the candidates replace the text.
+// Expressions are completed by the current session's adapter.
+func completer() func(line []rune, pos int) (int, []string) {
+	return func(line []rune, pos int) (int, []string) {
+		// Find the command name, and where its arguments begin.
+		i := skipSpaces(line, 0, pos)
+		nameStart := i
+		for i < pos && line[i] != ' ' {
+			i++
+		}
+		name := string(line[nameStart:i])
+		if i == pos {
+			return nameStart, completeCommand(name)
+		}
+		argStart := skipSpaces(line, i, pos)
+		switch name {
+		case "eval", "exception", "p":
+			return completeExpression(currentSession(), line[argStart:], pos-argStart, argStart)
+		}
+		return pos, nil
+	}
+}
+
+func skipSpaces(line []rune, i, end int) int {
+	for i < end && line[i] == ' ' {
+		i++
+	}
+	return i
+}
+
+func completeCommand(prefix string) []string {
+	var matches []string
+	for name := range commands {
+		if strings.HasPrefix(name, prefix) {
+			matches = append(matches, name)
+		}
+	}
+	sort.Strings(matches)
+	return matches
+}
+
+// completeExpression asks the adapter to complete expr at column pos. The
+// returned start is offset by base, the expression's position in the line.
+func completeExpression(s *Session, expr []rune, pos, base int) (int, []string) {
+	if !s.getCapabilities().SupportsCompletionsRequest {
+		return base + pos, nil
+	}
+	args := CompletionsArgs{Text: string(expr), Column: pos}
+	if s.opts.InitializeArgs.ColumnsStartAt1 {
+		args.Column++
+	}
+	if frame, ok := s.getSelectedFrame(); ok {
+		args.FrameID = frame.ID
+	}
+	resp, err := sendAndWait(s, CompletionsRequest(args))
+	if err != nil {
+		return base + pos, nil
+	}
+	var body CompletionsResponseBody
+	if err := json.Unmarshal(resp.Body, &body); err != nil || len(body.Targets) == 0 {
+		return base + pos, nil
+	}
+
+	// Items may each replace a different range, but the line editor takes
+	// a single one, so use the first item's and fall back to the word
+	// before the cursor.
+	start := pos
+	for start > 0 && isIdentRune(expr[start-1]) {
+		start--
+	}
+	if first := body.Targets[0]; first.Start != nil {
+		start = *first.Start
+		if s.opts.InitializeArgs.ColumnsStartAt1 {
+			start--
+		}
+	}
+	var candidates []string
+	for _, item := range body.Targets {
+		text := item.Text
+		if text == "" {
+			text = item.Label
+		}
+		candidates = append(candidates, text)
+	}
+	sort.Strings(candidates)
+	return base + start, candidates
+}
+
+func isIdentRune(r rune) bool {
+	return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
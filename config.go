@@ -0,0 +1,202 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// defaultConfigPath is where the config file is looked for unless --config
+// says otherwise. It's fine for it not to exist.
+const defaultConfigPath = ".dap-cli.json"
+
+// ConfigFile holds named debug configurations, like a minimal version of
+// VS Code's launch.json.
+type ConfigFile struct {
+	Configurations []Configuration `json:"configurations"`
+	// StepIntoFilter holds globs of source paths that step steps back out
+	// of, such as those of libraries.
+	StepIntoFilter []string `json:"stepIntoFilter,omitempty"`
+}
+
+type Configuration struct {
+	Name string `json:"name"`
+	// Adapter says how to reach the debug adapter. Transport arguments on
+	// the command line take precedence.
+	Adapter AdapterConfig `json:"adapter"`
+	// Request is either "launch" or "attach".
+	Request string `json:"request"`
+	// Arguments are sent as the launch or attach arguments.
+	Arguments json.RawMessage `json:"arguments"`
+}
+
+// AdapterConfig gives at most one way to connect to the adapter.
+type AdapterConfig struct {
+	// ID is sent as the adapter ID, and selects the schema launch
+	// arguments are checked against. It isn't a way to connect.
+	ID string `json:"id,omitempty"`
+	// TCP is the host:port the adapter listens on.
+	TCP string `json:"tcp,omitempty"`
+	// Unix is the path of the Unix socket the adapter listens on.
+	Unix string `json:"unix,omitempty"`
+	// Pipe is the name of the Windows named pipe the adapter listens on.
+	Pipe string `json:"pipe,omitempty"`
+	// Stdio is the command that starts the adapter.
+	Stdio []string `json:"stdio,omitempty"`
+}
+
+// count returns how many ways to connect the adapter config gives.
+func (a AdapterConfig) count() int {
+	n := 0
+	if a.TCP != "" {
+		n++
+	}
+	if a.Unix != "" {
+		n++
+	}
+	if a.Pipe != "" {
+		n++
+	}
+	if len(a.Stdio) > 0 {
+		n++
+	}
+	return n
+}
+
+// transportArgs returns the command-line transport arguments equivalent to
+// the adapter config, or nil if there is none.
+func (a AdapterConfig) transportArgs() []string {
+	switch {
+	case a.TCP != "":
+		return []string{"--tcp", a.TCP}
+	case a.Unix != "":
+		return []string{"--unix", a.Unix}
+	case a.Pipe != "":
+		return []string{"--pipe", a.Pipe}
+	case len(a.Stdio) > 0:
+		return append([]string{"--stdio", "--"}, a.Stdio...)
+	}
+	return nil
+}
+
+// loadConfig reads and validates the config file at path. A missing file is
+// only an error if it isn't the default one.
+func loadConfig(path string) (ConfigFile, error) {
+	var cfg ConfigFile
+	b, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) && path == defaultConfigPath {
+		return cfg, nil
+	}
+	if err != nil {
+		return cfg, err
+	}
+	d := json.NewDecoder(bytes.NewReader(b))
+	d.DisallowUnknownFields()
+	if err := d.Decode(&cfg); err != nil {
+		return cfg, fmt.Errorf("%s: %s", path, describeJSONError(b, err))
+	}
+	for i, pattern := range cfg.StepIntoFilter {
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			return cfg, fmt.Errorf("%s: stepIntoFilter[%d]: %s", path, i, err)
+		}
+	}
+	names := make(map[string]bool)
+	for i, c := range cfg.Configurations {
+		if err := c.validate(); err != nil {
+			return cfg, fmt.Errorf("%s: configurations[%d].%s", path, i, err)
+		}
+		if names[c.Name] {
+			return cfg, fmt.Errorf("%s: configurations[%d].name: duplicate name %q", path, i, c.Name)
+		}
+		names[c.Name] = true
+	}
+	return cfg, nil
+}
+
+// validate checks a configuration, returning errors that start with the
+// name of the offending field.
+func (c Configuration) validate() error {
+	if c.Name == "" {
+		return errors.New("name: missing")
+	}
+	if c.Adapter.count() > 1 {
+		return errors.New("adapter: only one of tcp, unix, pipe, and stdio may be given")
+	}
+	var err error
+	switch c.Request {
+	case "launch":
+		_, err = c.launchArgs()
+	case "attach":
+		_, err = c.attachArgs()
+	default:
+		return fmt.Errorf("request: must be launch or attach, got %q", c.Request)
+	}
+	if err != nil {
+		return fmt.Errorf("arguments: %s", describeJSONError(c.Arguments, err))
+	}
+	return nil
+}
+
+func (c Configuration) launchArgs() (LaunchRequestArgs, error) {
+	var args LaunchRequestArgs
+	raw, err := decodeWithRaw(c.Arguments, &args, "noDebug", "program", "args", "cwd", "env")
+	args.Raw = raw
+	return args, err
+}
+
+func (c Configuration) attachArgs() (AttachRequestArgs, error) {
+	var args AttachRequestArgs
+	raw, err := decodeWithRaw(c.Arguments, &args, "processId", "host", "port")
+	args.Raw = raw
+	return args, err
+}
+
+// decodeWithRaw decodes the JSON object b into v, and returns the keys other
+// than known, which v has no fields for.
+func decodeWithRaw(b json.RawMessage, v interface{}, known ...string) (map[string]interface{}, error) {
+	if len(b) == 0 {
+		return nil, nil
+	}
+	if err := json.Unmarshal(b, v); err != nil {
+		return nil, err
+	}
+	var raw map[string]interface{}
+	if err := json.Unmarshal(b, &raw); err != nil {
+		return nil, err
+	}
+	for _, key := range known {
+		delete(raw, key)
+	}
+	if len(raw) == 0 {
+		return nil, nil
+	}
+	return raw, nil
+}
+
+// describeJSONError explains a failure to decode b, naming the field or line
+// at fault where possible.
+func describeJSONError(b []byte, err error) string {
+	var typeErr *json.UnmarshalTypeError
+	var syntaxErr *json.SyntaxError
+	switch {
+	case errors.As(err, &typeErr) && typeErr.Field != "":
+		return fmt.Sprintf("%s: expected %s, got %s", typeErr.Field, typeErr.Type, typeErr.Value)
+	case errors.As(err, &syntaxErr):
+		line := bytes.Count(b[:syntaxErr.Offset], []byte("\n")) + 1
+		return fmt.Sprintf("line %d: %s", line, err)
+	}
+	return err.Error()
+}
+
+// findConfig returns the configuration with the given name.
+func (o *Options) findConfig(name string) (Configuration, bool) {
+	for _, c := range o.Config.Configurations {
+		if c.Name == name {
+			return c, true
+		}
+	}
+	return Configuration{}, false
+}
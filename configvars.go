@@ -0,0 +1,147 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// VarContext holds what the variables in configuration arguments, such as
+// ${workspaceFolder}, stand for.
+type VarContext struct {
+	// WorkspaceFolder is the directory the config file is in.
+	WorkspaceFolder string
+	// File is the source file of the current frame, if a thread is stopped.
+	File      string
+	Cwd       string
+	LookupEnv func(name string) (string, bool)
+
+	// out is where warnings go, and warned holds the variables already
+	// warned about, so each is only warned about once.
+	out    io.Writer
+	warned map[string]bool
+}
+
+// newVarContext returns the context for the configuration arguments about
+// to be sent.
+func newVarContext(s *Session) VarContext {
+	ctx := VarContext{LookupEnv: os.LookupEnv, out: s.opts.Out, warned: make(map[string]bool)}
+	if path, err := filepath.Abs(s.opts.ConfigPath); err == nil {
+		ctx.WorkspaceFolder = filepath.Dir(path)
+	}
+	ctx.Cwd, _ = os.Getwd()
+	if frames := s.getFrames(); len(frames) > 0 && frames[0].Source != nil {
+		ctx.File = frames[0].Source.Path
+	}
+	return ctx
+}
+
+// configVariable matches a variable like ${workspaceFolder} or ${env:HOME}.
+var configVariable = regexp.MustCompile(`\$\{([^}]*)\}`)
+
+// resolveVariables returns raw with the variables in its string values
+// replaced, the way VS Code does for launch.json. Variables it doesn't
+// know, or that have no value, are left as they are.
+func resolveVariables(raw map[string]interface{}, ctx VarContext) map[string]interface{} {
+	resolved, _ := ctx.resolve(raw).(map[string]interface{})
+	return resolved
+}
+
+func (ctx VarContext) resolve(v interface{}) interface{} {
+	switch v := v.(type) {
+	case string:
+		return configVariable.ReplaceAllStringFunc(v, func(token string) string {
+			name := token[2 : len(token)-1]
+			value, ok := ctx.lookup(name)
+			if !ok {
+				ctx.warn(token, "warning: %s has no value here; leaving it as it is", token)
+				return token
+			}
+			return value
+		})
+	case []interface{}:
+		resolved := make([]interface{}, len(v))
+		for i, elem := range v {
+			resolved[i] = ctx.resolve(elem)
+		}
+		return resolved
+	case map[string]interface{}:
+		resolved := make(map[string]interface{}, len(v))
+		for key, elem := range v {
+			resolved[key] = ctx.resolve(elem)
+		}
+		return resolved
+	}
+	return v
+}
+
+// lookup returns the value of the variable called name, and whether it has
+// one.
+func (ctx VarContext) lookup(name string) (string, bool) {
+	if env := strings.TrimPrefix(name, "env:"); env != name {
+		value, ok := ctx.LookupEnv(env)
+		if !ok {
+			// VS Code substitutes nothing for unset variables, which
+			// is usually what's meant.
+			ctx.warn(name, "warning: environment variable %s is not set", env)
+		}
+		return value, true
+	}
+	var value string
+	switch name {
+	case "workspaceFolder", "workspaceRoot":
+		value = ctx.WorkspaceFolder
+	case "workspaceFolderBasename":
+		if ctx.WorkspaceFolder != "" {
+			value = filepath.Base(ctx.WorkspaceFolder)
+		}
+	case "file":
+		value = ctx.File
+	case "fileBasename":
+		if ctx.File != "" {
+			value = filepath.Base(ctx.File)
+		}
+	case "fileDirname":
+		if ctx.File != "" {
+			value = filepath.Dir(ctx.File)
+		}
+	case "fileExtname":
+		value = filepath.Ext(ctx.File)
+	case "cwd":
+		value = ctx.Cwd
+	case "userHome":
+		value, _ = os.UserHomeDir()
+	case "pathSeparator":
+		value = string(filepath.Separator)
+	}
+	return value, value != ""
+}
+
+func (ctx VarContext) warn(key, format string, args ...interface{}) {
+	if ctx.warned[key] {
+		return
+	}
+	if ctx.warned != nil {
+		ctx.warned[key] = true
+	}
+	fmt.Fprintf(ctx.out, format+"\n", args...)
+}
+
+// resolved returns the configuration with the variables in its arguments
+// replaced by resolveVariables.
+func (c Configuration) resolved(ctx VarContext) Configuration {
+	var raw map[string]interface{}
+	if len(c.Arguments) == 0 || json.Unmarshal(c.Arguments, &raw) != nil {
+		return c
+	}
+	b, err := json.Marshal(resolveVariables(raw, ctx))
+	if err != nil {
+		return c
+	}
+	c.Arguments = b
+	return c
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"testing"
+)
+
+func testVarContext(env map[string]string) VarContext {
+	return VarContext{
+		WorkspaceFolder: "/home/me/proj",
+		File:            "/home/me/proj/cmd/main.go",
+		Cwd:             "/tmp",
+		LookupEnv: func(name string) (string, bool) {
+			value, ok := env[name]
+			return value, ok
+		},
+		out:    io.Discard,
+		warned: make(map[string]bool),
+	}
+}
+
+func TestResolveVariables(t *testing.T) {
+	ctx := testVarContext(map[string]string{"GOFLAGS": "-race", "PORT": "8080"})
+	raw := map[string]interface{}{
+		"program": "${workspaceFolder}/cmd",
+		"args":    []interface{}{"--port=${env:PORT}", "${fileBasename}", 3.0},
+		"env":     map[string]interface{}{"GOFLAGS": "${env:GOFLAGS} -v"},
+		"cwd":     "${fileDirname}",
+	}
+	got := resolveVariables(raw, ctx)
+	want := map[string]interface{}{
+		"program": "/home/me/proj/cmd",
+		"args":    []interface{}{"--port=8080", "main.go", 3.0},
+		"env":     map[string]interface{}{"GOFLAGS": "-race -v"},
+		"cwd":     "/home/me/proj/cmd",
+	}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestResolveMissingVariables(t *testing.T) {
+	ctx := testVarContext(nil)
+	raw := map[string]interface{}{
+		"program": "${command:pickProgram}",
+		"args":    []interface{}{"${command:pickProgram}", "-token=${env:TOKEN}"},
+	}
+	got := resolveVariables(raw, ctx)
+	want := map[string]interface{}{
+		"program": "${command:pickProgram}",
+		// Unset environment variables become empty, as in VS Code.
+		"args": []interface{}{"${command:pickProgram}", "-token="},
+	}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	for _, key := range []string{"${command:pickProgram}", "env:TOKEN"} {
+		if !ctx.warned[key] {
+			t.Errorf("no warning about %s", key)
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// defaultDisassembleCount is the number of instructions disas shows when
+// not told otherwise.
+const defaultDisassembleCount = 16
+
+type DisassembleArgs struct {
+	MemoryReference   string `json:"memoryReference"`
+	Offset            int    `json:"offset,omitempty"`
+	InstructionOffset int    `json:"instructionOffset,omitempty"`
+	InstructionCount  int    `json:"instructionCount"`
+	ResolveSymbols    bool   `json:"resolveSymbols,omitempty"`
+}
+
+type DisassembledInstruction struct {
+	Address          string  `json:"address"`
+	InstructionBytes string  `json:"instructionBytes,omitempty"`
+	Instruction      string  `json:"instruction"`
+	Symbol           string  `json:"symbol,omitempty"`
+	Location         *Source `json:"location,omitempty"`
+	Line             int     `json:"line,omitempty"`
+}
+
+type DisassembleResponseBody struct {
+	Instructions []DisassembledInstruction `json:"instructions"`
+}
+
+func DisassembleRequest(args DisassembleArgs) Request {
+	return Request{
+		ProtocolMessage: NewRequest(),
+		Command:         "disassemble",
+		Arguments:       args,
+	}
+}
+
+// sameAddress reports whether two memory references name the same address,
+// comparing them as numbers where possible.
+func sameAddress(a, b string) bool {
+	x, errA := strconv.ParseUint(a, 0, 64)
+	y, errB := strconv.ParseUint(b, 0, 64)
+	if errA != nil || errB != nil {
+		return a == b
+	}
+	return x == y
+}
+
+func disassembleCommand(s *Session, args []string) error {
+	count := defaultDisassembleCount
+	if len(args) > 0 {
+		n, err := strconv.Atoi(args[0])
+		if err != nil || n <= 0 {
+			return fmt.Errorf("bad instruction count %q", args[0])
+		}
+		count = n
+	}
+	if err := checkSupported(s, "disassemble"); err != nil {
+		return err
+	}
+	frame, err := currentFrame(s)
+	if err != nil {
+		return err
+	}
+	ip := frame.InstructionPointerReference
+	if ip == "" {
+		return fmt.Errorf("no instruction pointer for %s", frame.Name)
+	}
+	// Center the listing on the current instruction.
+	req := DisassembleRequest(DisassembleArgs{
+		MemoryReference:   ip,
+		InstructionOffset: -count / 2,
+		InstructionCount:  count,
+		ResolveSymbols:    true,
+	})
+	resp, err := sendAndWait(s, req)
+	if err != nil {
+		return err
+	}
+	var body DisassembleResponseBody
+	if err := json.Unmarshal(resp.Body, &body); err != nil {
+		return fmt.Errorf("failed to read disassembly: %s", err)
+	}
+	width := 0
+	for _, inst := range body.Instructions {
+		if len(inst.Address) > width {
+			width = len(inst.Address)
+		}
+	}
+	for _, inst := range body.Instructions {
+		marker := "  "
+		if sameAddress(inst.Address, ip) {
+			marker = "=>"
+		}
+		line := fmt.Sprintf("%s %*s: %-20s %s", marker, width, inst.Address, inst.InstructionBytes, inst.Instruction)
+		if inst.Symbol != "" {
+			line += fmt.Sprintf(" <%s>", inst.Symbol)
+		}
+		if inst.Location != nil && inst.Line != 0 {
+			line += "  ; " + formatLocation(s, inst.Location, inst.Line)
+		}
+		line = strings.TrimRight(line, " ")
+		if marker == "=>" {
+			line = colorize(colorGreen, line)
+		}
+		fmt.Fprintln(s.opts.Out, line)
+	}
+	return nil
+}
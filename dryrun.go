@@ -0,0 +1,50 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// dryRunConn stands in for the connection to an adapter in a dry run.
+// Nothing is ever read from it, and whatever is written to it is dropped.
+type dryRunConn struct{}
+
+func (dryRunConn) Read(p []byte) (int, error)  { return 0, io.EOF }
+func (dryRunConn) Write(p []byte) (int, error) { return len(p), nil }
+func (dryRunConn) Close() error                { return nil }
+
+// startDryRun sets up the session so that the commands that need a launched
+// debuggee with a stopped thread have one to act on.
+func startDryRun(s *Session) {
+	s.setDryRun()
+	s.setMode(modeLaunch)
+	s.setConfigured()
+	s.setStopped(1)
+	fmt.Fprintln(s.opts.Out, "dry run: requests are printed, not sent; thread 1 is treated as stopped")
+}
+
+// printRequest prints req as it would have been sent in a dry run.
+func printRequest(s *Session, req Request) {
+	if s.opts.JSON {
+		printJSON(s, req)
+	} else if b, err := json.MarshalIndent(req, "", "  "); err != nil {
+		printError(s, "failed to encode request: %s", err)
+	} else {
+		fmt.Fprintln(s.opts.Out, string(b))
+	}
+}
+
+// dryRunResponse hands req to cl.DryRun as it would have been sent, and
+// returns an empty successful response in place of the adapter's.
+func (cl *Client) dryRunResponse(req Request) Response {
+	req.Seq = cl.nextSeq()
+	cl.DryRun(req)
+	return Response{
+		ProtocolMessage: ProtocolMessage{Type: "response"},
+		RequestSeq:      req.Seq,
+		Success:         true,
+		Command:         req.Command,
+		Body:            json.RawMessage("{}"),
+	}
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+type ExceptionInfoArgs struct {
+	ThreadID int `json:"threadId"`
+}
+
+type ExceptionDetails struct {
+	Message        string             `json:"message,omitempty"`
+	TypeName       string             `json:"typeName,omitempty"`
+	FullTypeName   string             `json:"fullTypeName,omitempty"`
+	StackTrace     string             `json:"stackTrace,omitempty"`
+	InnerException []ExceptionDetails `json:"innerException,omitempty"`
+}
+
+type ExceptionInfoResponseBody struct {
+	ExceptionID string `json:"exceptionId"`
+	Description string `json:"description,omitempty"`
+	// BreakMode is one of never, always, unhandled, or userUnhandled.
+	BreakMode string            `json:"breakMode"`
+	Details   *ExceptionDetails `json:"details,omitempty"`
+}
+
+func ExceptionInfoRequest(args ExceptionInfoArgs) Request {
+	return Request{
+		ProtocolMessage: NewRequest(),
+		Command:         "exceptionInfo",
+		Arguments:       args,
+	}
+}
+
+// exceptionInfo fetches the exception that threadID stopped on, and keeps
+// it for the exception command.
+func exceptionInfo(s *Session, threadID int) (ExceptionInfoResponseBody, error) {
+	resp, err := sendAndWait(s, ExceptionInfoRequest(ExceptionInfoArgs{ThreadID: threadID}))
+	if err != nil {
+		return ExceptionInfoResponseBody{}, err
+	}
+	var body ExceptionInfoResponseBody
+	if err := json.Unmarshal(resp.Body, &body); err != nil {
+		return ExceptionInfoResponseBody{}, fmt.Errorf("failed to read exception info: %s", err)
+	}
+	s.setLastException(body)
+	return body, nil
+}
+
+func printExceptionInfo(s *Session, info ExceptionInfoResponseBody) {
+	fmt.Fprintf(s.opts.Out, "exception %s (break mode: %s)\n", colorize(colorRed, info.ExceptionID), info.BreakMode)
+	if info.Description != "" {
+		fmt.Fprintf(s.opts.Out, "  %s\n", info.Description)
+	}
+	if info.Details != nil {
+		printExceptionDetails(s, *info.Details, "  ")
+	}
+}
+
+func printExceptionDetails(s *Session, details ExceptionDetails, indent string) {
+	typeName := details.FullTypeName
+	if typeName == "" {
+		typeName = details.TypeName
+	}
+	switch {
+	case typeName != "" && details.Message != "":
+		fmt.Fprintf(s.opts.Out, "%s%s: %s\n", indent, typeName, details.Message)
+	case typeName != "":
+		fmt.Fprintf(s.opts.Out, "%s%s\n", indent, typeName)
+	case details.Message != "":
+		fmt.Fprintf(s.opts.Out, "%s%s\n", indent, details.Message)
+	}
+	if details.StackTrace != "" {
+		for _, line := range strings.Split(strings.TrimRight(details.StackTrace, "\n"), "\n") {
+			fmt.Fprintf(s.opts.Out, "%s  %s\n", indent, line)
+		}
+	}
+	for _, inner := range details.InnerException {
+		fmt.Fprintf(s.opts.Out, "%scaused by:\n", indent)
+		printExceptionDetails(s, inner, indent+"  ")
+	}
+}
+
+func exceptionCommand(s *Session, args []string) error {
+	info, ok := s.getLastException()
+	if !ok {
+		fmt.Fprintln(s.opts.Out, "no exception has been caught")
+		return nil
+	}
+	printExceptionInfo(s, info)
+	return nil
+}
@@ -0,0 +1,661 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+type StoppedEventBody struct {
+	Reason            string `json:"reason"`
+	Description       string `json:"description"`
+	ThreadID          int    `json:"threadId"`
+	Text              string `json:"text"`
+	AllThreadsStopped bool   `json:"allThreadsStopped"`
+	HitBreakpointIds  []int  `json:"hitBreakpointIds"`
+}
+
+type ContinueArgs struct {
+	ThreadID     int  `json:"threadId"`
+	SingleThread bool `json:"singleThread,omitempty"`
+}
+
+type ContinueResponseBody struct {
+	// AllThreadsContinued is treated as true when omitted.
+	AllThreadsContinued *bool `json:"allThreadsContinued"`
+}
+
+func ContinueRequest(args ContinueArgs) Request {
+	return Request{
+		ProtocolMessage: NewRequest(),
+		Command:         "continue",
+		Arguments:       args,
+	}
+}
+
+type NextArgs struct {
+	ThreadID    int    `json:"threadId"`
+	Granularity string `json:"granularity,omitempty"`
+}
+
+func NextRequest(args NextArgs) Request {
+	return Request{
+		ProtocolMessage: NewRequest(),
+		Command:         "next",
+		Arguments:       args,
+	}
+}
+
+type StepInArgs struct {
+	ThreadID int `json:"threadId"`
+	// TargetID picks which of the stepInTargets to step into.
+	TargetID    int    `json:"targetId,omitempty"`
+	Granularity string `json:"granularity,omitempty"`
+}
+
+func StepInRequest(args StepInArgs) Request {
+	return Request{
+		ProtocolMessage: NewRequest(),
+		Command:         "stepIn",
+		Arguments:       args,
+	}
+}
+
+type StepInTargetsArgs struct {
+	FrameID int `json:"frameId"`
+}
+
+type StepInTarget struct {
+	ID    int    `json:"id"`
+	Label string `json:"label"`
+}
+
+type StepInTargetsResponseBody struct {
+	Targets []StepInTarget `json:"targets"`
+}
+
+func StepInTargetsRequest(args StepInTargetsArgs) Request {
+	return Request{
+		ProtocolMessage: NewRequest(),
+		Command:         "stepInTargets",
+		Arguments:       args,
+	}
+}
+
+type StepOutArgs struct {
+	ThreadID    int    `json:"threadId"`
+	Granularity string `json:"granularity,omitempty"`
+}
+
+func StepOutRequest(args StepOutArgs) Request {
+	return Request{
+		ProtocolMessage: NewRequest(),
+		Command:         "stepOut",
+		Arguments:       args,
+	}
+}
+
+type StepBackArgs struct {
+	ThreadID    int    `json:"threadId"`
+	Granularity string `json:"granularity,omitempty"`
+}
+
+func StepBackRequest(args StepBackArgs) Request {
+	return Request{
+		ProtocolMessage: NewRequest(),
+		Command:         "stepBack",
+		Arguments:       args,
+	}
+}
+
+type ReverseContinueArgs struct {
+	ThreadID int `json:"threadId"`
+}
+
+func ReverseContinueRequest(args ReverseContinueArgs) Request {
+	return Request{
+		ProtocolMessage: NewRequest(),
+		Command:         "reverseContinue",
+		Arguments:       args,
+	}
+}
+
+type GotoTargetsArgs struct {
+	Source Source `json:"source"`
+	Line   int    `json:"line"`
+}
+
+type GotoTarget struct {
+	ID     int    `json:"id"`
+	Label  string `json:"label"`
+	Line   int    `json:"line"`
+	Column int    `json:"column,omitempty"`
+}
+
+type GotoTargetsResponseBody struct {
+	Targets []GotoTarget `json:"targets"`
+}
+
+func GotoTargetsRequest(args GotoTargetsArgs) Request {
+	return Request{
+		ProtocolMessage: NewRequest(),
+		Command:         "gotoTargets",
+		Arguments:       args,
+	}
+}
+
+type GotoArgs struct {
+	ThreadID int `json:"threadId"`
+	TargetID int `json:"targetId"`
+}
+
+func GotoRequest(args GotoArgs) Request {
+	return Request{
+		ProtocolMessage: NewRequest(),
+		Command:         "goto",
+		Arguments:       args,
+	}
+}
+
+type PauseArgs struct {
+	ThreadID int `json:"threadId"`
+}
+
+func PauseRequest(args PauseArgs) Request {
+	return Request{
+		ProtocolMessage: NewRequest(),
+		Command:         "pause",
+		Arguments:       args,
+	}
+}
+
+func handleStopped(s *Session, event Event) {
+	var body StoppedEventBody
+	if err := json.Unmarshal(event.Body, &body); err != nil {
+		printError(s, "failed to read stopped event: %s", err)
+		s.notifyEvent("stopped")
+		return
+	}
+	s.setStopped(body.ThreadID)
+	// Finding the location takes a round trip to the adapter, which can't
+	// be waited for on the listen goroutine.
+	go func() {
+		defer s.notifyEvent("stopped")
+		// The whole stack is fetched now, so the commands that look at
+		// it don't have to wait for it later.
+		levels := defaultStackLevels
+		if s.opts.NoAutoStack {
+			levels = 1
+		}
+		frames, err := stackTrace(s, body.ThreadID, levels)
+		if err == nil && !s.opts.NoAutoStack {
+			s.setStopFrames(body.ThreadID, frames)
+		}
+		fmt.Fprintln(s.opts.Out, describeStop(s, body, frames))
+		if body.Reason == "exception" && !s.opts.JSON && checkSupported(s, "exceptionInfo") == nil {
+			info, err := exceptionInfo(s, body.ThreadID)
+			if err != nil {
+				printError(s, "%s", err)
+			} else {
+				printExceptionInfo(s, info)
+			}
+		}
+		printWatches(s, body.ThreadID)
+	}()
+}
+
+// describeStop explains why and where a thread stopped, as in "stopped in
+// thread 1: breakpoint hit at main.go:42 in main.main". frames is the
+// thread's stack, if it could be fetched.
+func describeStop(s *Session, body StoppedEventBody, frames []StackFrame) string {
+	reason := body.Description
+	if reason == "" {
+		reason = body.Reason
+		if reason == "breakpoint" {
+			reason = "breakpoint hit"
+		}
+	}
+	if body.Text != "" {
+		reason += fmt.Sprintf(" (%s)", body.Text)
+	}
+	desc := fmt.Sprintf("stopped in thread %d: %s", body.ThreadID, reason)
+	if len(frames) == 0 {
+		return desc
+	}
+	return fmt.Sprintf("%s at %s in %s", desc, formatLocation(s, frames[0].Source, frames[0].Line), frames[0].Name)
+}
+
+func continueCommand(s *Session, args []string) error {
+	if s.getMode() == modeNone {
+		return errors.New("no active session; use launch or attach first")
+	}
+	if _, stopped := s.getCurrentThread(); !stopped {
+		return errors.New("no thread is stopped")
+	}
+	return continueThread(s)
+}
+
+// continueThread resumes the current thread.
+func continueThread(s *Session) error {
+	threadID, _ := s.getCurrentThread()
+	req := ContinueRequest(ContinueArgs{ThreadID: threadID})
+	// Mark the thread as running before sending, since the next stopped
+	// event can be handled before the response is.
+	s.setRunning()
+	resp, err := sendAndWait(s, req)
+	if err != nil {
+		s.setStopped(threadID)
+		return err
+	}
+	var body ContinueResponseBody
+	if len(resp.Body) > 0 {
+		if err := json.Unmarshal(resp.Body, &body); err != nil {
+			return fmt.Errorf("failed to read continue response: %s", err)
+		}
+	}
+	if body.AllThreadsContinued != nil && !*body.AllThreadsContinued {
+		fmt.Fprintf(s.opts.Out, "thread %d continued; other threads remain stopped\n", threadID)
+	}
+	return nil
+}
+
+// untilCommand runs to a line by setting a temporary breakpoint there,
+// continuing, and removing the breakpoint again once the thread stops,
+// wherever that is.
+func untilCommand(s *Session, args []string) error {
+	if len(args) != 1 {
+		return errors.New("usage: until <file>:<line>")
+	}
+	path, line, err := parseLocation(args[0])
+	if err != nil {
+		return err
+	}
+	if s.getMode() == modeNone {
+		return errors.New("no active session; use launch or attach first")
+	}
+	if _, stopped := s.getCurrentThread(); !stopped {
+		return errors.New("no thread is stopped")
+	}
+	bps := s.getBreakpoints()[path]
+	// The breakpoints sent while running to the line are the user's, with
+	// one that stops there whatever happens.
+	sent := append([]SourceBreakpoint(nil), bps...)
+	temporary, at := true, len(bps)
+	for i, bp := range bps {
+		if bp.Line != protocolLine(s, line) {
+			continue
+		}
+		if bp.Condition == "" && bp.HitCondition == "" && bp.LogMessage == "" {
+			// The user's breakpoint will stop there anyway, and must
+			// outlive this command.
+			temporary = false
+		} else {
+			// The user's breakpoint may not stop there, so it's swapped
+			// for one that will until the thread stops.
+			sent[i] = SourceBreakpoint{Line: bp.Line, Column: bp.Column}
+			at = i
+		}
+	}
+	if temporary {
+		if at == len(bps) {
+			sent = append(sent, SourceBreakpoint{Line: protocolLine(s, line)})
+		}
+		results, err := sendBreakpoints(s, path, sent)
+		if err != nil {
+			return err
+		}
+		if at < len(results) && !results[at].Verified {
+			fmt.Fprintf(s.opts.Out, "warning: temporary breakpoint at %s:%d not verified\n", filepath.Base(path), line)
+		}
+		if len(results) > len(bps) {
+			results = results[:len(bps)]
+		}
+		s.setBreakpointResults(path, results)
+	}
+
+	threadID, _ := s.getCurrentThread()
+	stop := s.waitForStop()
+	terminated := s.waitForEvent("terminated")
+	stopped := false
+	err = continueThread(s)
+	if err == nil {
+		stopped, err = waitForStopped(s, threadID, stop, terminated)
+	}
+	if temporary && !s.isDisconnected() && s.getMode() != modeNone {
+		// This also restores a breakpoint that was swapped out. Breakpoints
+		// may have changed while the thread was running.
+		bps := s.getBreakpoints()[path]
+		if bps == nil {
+			bps = []SourceBreakpoint{}
+		}
+		results, err := sendBreakpoints(s, path, bps)
+		if err != nil {
+			return fmt.Errorf("failed to restore breakpoints: %s", err)
+		}
+		s.setBreakpointResults(path, results)
+	}
+	if err != nil {
+		return err
+	}
+	if !stopped || !stoppedAt(s, path, line) {
+		if _, stopped := s.getCurrentThread(); stopped {
+			fmt.Fprintf(s.opts.Out, "stopped before reaching %s:%d\n", filepath.Base(path), line)
+		}
+	}
+	return nil
+}
+
+// stoppedAt reports whether the current thread is stopped at line of path.
+func stoppedAt(s *Session, path string, line int) bool {
+	frames, err := cachedFrames(s)
+	if err != nil || len(frames) == 0 || frames[0].Source == nil {
+		return false
+	}
+	return filepath.Clean(frames[0].Source.Path) == path && displayLine(s, frames[0].Line) == line
+}
+
+// waitForStopped waits for stop or terminated, and reports whether the
+// thread stopped. Ctrl-C while waiting pauses threadID, and pressing it
+// again gives up waiting.
+func waitForStopped(s *Session, threadID int, stop, terminated <-chan struct{}) (bool, error) {
+	intr := s.opts.interrupted()
+	paused := false
+	for {
+		select {
+		case <-stop:
+			return true, nil
+		case <-terminated:
+			return false, nil
+		case <-intr:
+			if paused {
+				fmt.Fprintf(s.opts.Out, "thread %d is still running; no longer waiting for it\n", threadID)
+				return false, nil
+			}
+			paused = true
+			intr = s.opts.interrupted()
+			if _, err := sendAndWait(s, PauseRequest(PauseArgs{ThreadID: threadID})); err != nil {
+				return false, err
+			}
+		}
+	}
+}
+
+// parseGranularity returns the stepping granularity given as the optional
+// argument to a stepping command.
+func parseGranularity(args []string) (string, error) {
+	if len(args) == 0 {
+		return "", nil
+	}
+	switch args[0] {
+	case "statement", "line", "instruction":
+		return args[0], nil
+	}
+	return "", fmt.Errorf("unknown granularity %q: expected statement, line, or instruction", args[0])
+}
+
+// step sends a stepping request built by newRequest for the current thread
+// and waits for the thread to stop again, pausing it on Ctrl-C.
+func step(s *Session, args []string, newRequest func(threadID int, granularity string) Request) (bool, error) {
+	if s.getMode() == modeNone {
+		return false, errors.New("no active session; use launch or attach first")
+	}
+	threadID, stopped := s.getCurrentThread()
+	if !stopped {
+		return false, errors.New("no thread is stopped")
+	}
+	granularity, err := parseGranularity(args)
+	if err != nil {
+		return false, err
+	}
+	req := newRequest(threadID, granularity)
+	stop := s.waitForStop()
+	terminated := s.waitForEvent("terminated")
+	s.setRunning()
+	if _, err := sendAndWait(s, req); err != nil {
+		s.setStopped(threadID)
+		return false, err
+	}
+	return waitForStopped(s, threadID, stop, terminated)
+}
+
+func nextCommand(s *Session, args []string) error {
+	_, err := step(s, args, func(threadID int, granularity string) Request {
+		return NextRequest(NextArgs{ThreadID: threadID, Granularity: granularity})
+	})
+	return err
+}
+
+func stepInCommand(s *Session, args []string) error {
+	var targetID int
+	if len(args) > 0 && args[0] == "choose" {
+		args = args[1:]
+		var err error
+		if targetID, err = chooseStepInTarget(s); err != nil {
+			return err
+		}
+	}
+	stopped, err := step(s, args, func(threadID int, granularity string) Request {
+		return StepInRequest(StepInArgs{ThreadID: threadID, TargetID: targetID, Granularity: granularity})
+	})
+	if err != nil || !stopped {
+		return err
+	}
+	return skipFiltered(s)
+}
+
+// chooseStepInTarget asks the user which call on the current line to step
+// into. It returns 0, meaning a plain step in, if there's nothing to choose
+// between.
+func chooseStepInTarget(s *Session) (int, error) {
+	if checkSupported(s, "stepInTargets") != nil {
+		return 0, nil
+	}
+	frame, err := currentFrame(s)
+	if err != nil {
+		return 0, err
+	}
+	resp, err := sendAndWait(s, StepInTargetsRequest(StepInTargetsArgs{FrameID: frame.ID}))
+	if err != nil {
+		return 0, err
+	}
+	var body StepInTargetsResponseBody
+	if err := json.Unmarshal(resp.Body, &body); err != nil {
+		return 0, fmt.Errorf("failed to read step in targets: %s", err)
+	}
+	if len(body.Targets) <= 1 {
+		return 0, nil
+	}
+	labels := make([]string, len(body.Targets))
+	for i, t := range body.Targets {
+		labels[i] = t.Label
+	}
+	i, err := choose(s, labels)
+	if err != nil {
+		return 0, err
+	}
+	return body.Targets[i].ID, nil
+}
+
+func stepOutCommand(s *Session, args []string) error {
+	_, err := step(s, args, func(threadID int, granularity string) Request {
+		return StepOutRequest(StepOutArgs{ThreadID: threadID, Granularity: granularity})
+	})
+	return err
+}
+
+// finishCommand steps out of the current function, like stepout, and then
+// shows what it returned if the adapter says.
+func finishCommand(s *Session, args []string) error {
+	stopped, err := step(s, args, func(threadID int, granularity string) Request {
+		return StepOutRequest(StepOutArgs{ThreadID: threadID, Granularity: granularity})
+	})
+	if err != nil || !stopped {
+		return err
+	}
+	frame, err := currentFrame(s)
+	if err != nil {
+		return err
+	}
+	values, err := returnValues(s, frame.ID)
+	if err != nil {
+		return err
+	}
+	if len(values) == 0 {
+		fmt.Fprintln(s.opts.Out, "the adapter did not report a return value")
+		return nil
+	}
+	printVariables(s, values, "")
+	return nil
+}
+
+// returnValues finds the values the function just stepped out of returned
+// among the variables of frameID. There's no request for them, but adapters
+// that report them put them in the caller's scopes, each under its own name.
+func returnValues(s *Session, frameID int) ([]Variable, error) {
+	frameScopes, err := scopes(s, frameID)
+	if err != nil {
+		return nil, err
+	}
+	var values []Variable
+	for _, scope := range frameScopes {
+		if scope.Expensive {
+			continue
+		}
+		vars, err := variables(s, scope.VariablesReference)
+		if err != nil {
+			return nil, err
+		}
+		wholeScope := isReturnValue(scope.Name)
+		for _, v := range vars {
+			if wholeScope || isReturnValue(v.Name) {
+				values = append(values, v)
+			}
+		}
+	}
+	return values, nil
+}
+
+// isReturnValue reports whether name is one that adapters give return
+// values: "(return) f" in debugpy, "Return value" in js-debug, and "~r0"
+// and so on for Go's unnamed results in Delve.
+func isReturnValue(name string) bool {
+	return strings.HasPrefix(name, "(return)") ||
+		strings.HasPrefix(name, "~r") ||
+		strings.EqualFold(name, "return value") ||
+		strings.EqualFold(name, "return values")
+}
+
+func stepBackCommand(s *Session, args []string) error {
+	// Adapters that can step back can also run backwards.
+	if err := checkSupported(s, "stepBack"); err != nil {
+		return err
+	}
+	_, err := step(s, args, func(threadID int, granularity string) Request {
+		return StepBackRequest(StepBackArgs{ThreadID: threadID, Granularity: granularity})
+	})
+	return err
+}
+
+// reverseContinueCommand runs backwards until something stops the thread.
+// Unlike continue, it waits for that, since going backwards always ends at
+// a stop, if only at the start of the recording.
+func reverseContinueCommand(s *Session, args []string) error {
+	// Adapters that can step back can also run backwards.
+	if err := checkSupported(s, "stepBack"); err != nil {
+		return err
+	}
+	if len(args) > 0 {
+		return errors.New("usage: rc")
+	}
+	_, err := step(s, nil, func(threadID int, granularity string) Request {
+		return ReverseContinueRequest(ReverseContinueArgs{ThreadID: threadID})
+	})
+	return err
+}
+
+// gotoCommand moves the current thread to another line without running the
+// code in between.
+func gotoCommand(s *Session, args []string) error {
+	if len(args) != 1 {
+		return errors.New("usage: goto <file>:<line>")
+	}
+	if err := checkSupported(s, "gotoTargets"); err != nil {
+		return err
+	}
+	if _, stopped := s.getCurrentThread(); !stopped {
+		return errors.New("no thread is stopped")
+	}
+	path, line, err := parseLocation(args[0])
+	if err != nil {
+		return err
+	}
+	req := GotoTargetsRequest(GotoTargetsArgs{
+		Source: Source{Name: filepath.Base(path), Path: path},
+		Line:   protocolLine(s, line),
+	})
+	resp, err := sendAndWait(s, req)
+	if err != nil {
+		return err
+	}
+	var body GotoTargetsResponseBody
+	if err := json.Unmarshal(resp.Body, &body); err != nil {
+		return fmt.Errorf("failed to read goto targets: %s", err)
+	}
+	if len(body.Targets) == 0 {
+		return fmt.Errorf("can't jump to %s", args[0])
+	}
+	target := body.Targets[0]
+	if len(body.Targets) > 1 {
+		labels := make([]string, len(body.Targets))
+		for i, t := range body.Targets {
+			labels[i] = t.Label
+		}
+		i, err := choose(s, labels)
+		if err != nil {
+			return err
+		}
+		target = body.Targets[i]
+	}
+	_, err = step(s, nil, func(threadID int, granularity string) Request {
+		return GotoRequest(GotoArgs{ThreadID: threadID, TargetID: target.ID})
+	})
+	return err
+}
+
+func pauseCommand(s *Session, args []string) error {
+	if s.getMode() == modeNone {
+		return errors.New("no active session; use launch or attach first")
+	}
+	threadID, stopped := s.getCurrentThread()
+	if stopped {
+		return fmt.Errorf("thread %d is already stopped", threadID)
+	}
+	if threadID == 0 {
+		// Nothing has stopped yet, so pick a thread to pause. Most adapters
+		// stop every thread regardless.
+		list, err := threads(s)
+		if err != nil {
+			return err
+		}
+		if len(list) == 0 {
+			return errors.New("no threads to pause")
+		}
+		threadID = list[0].ID
+	}
+	req := PauseRequest(PauseArgs{ThreadID: threadID})
+	stop := s.waitForStop()
+	terminated := s.waitForEvent("terminated")
+	intr := s.opts.interrupted()
+	if _, err := sendAndWait(s, req); err != nil {
+		return err
+	}
+	select {
+	case <-stop:
+	case <-terminated:
+	case <-intr:
+		fmt.Fprintf(s.opts.Out, "thread %d has not stopped yet; no longer waiting for it\n", threadID)
+	}
+	return nil
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+)
+
+// serveStepping answers every request until the connection closes. Each
+// response to one of the stepping commands is followed by a stopped event
+// for thread 1. The commands the adapter is sent come out of the returned
+// channel.
+func (a *fakeAdapter) serveStepping(stepping ...string) <-chan string {
+	commands := make(chan string, 100)
+	go func() {
+		for {
+			req, err := a.readRequest()
+			if err != nil {
+				return
+			}
+			commands <- req.Command
+			if err := a.respond(req, map[string]interface{}{}); err != nil {
+				return
+			}
+			for _, command := range stepping {
+				if req.Command == command {
+					a.sendEvent("stopped", map[string]interface{}{"reason": "step", "threadId": 1})
+				}
+			}
+		}
+	}()
+	return commands
+}
+
+// nextCommandSent returns the next command the adapter was sent, failing the
+// test if there isn't one.
+func nextCommandSent(t *testing.T, commands <-chan string) string {
+	t.Helper()
+	select {
+	case command := <-commands:
+		return command
+	case <-time.After(time.Second):
+		t.Fatal("no request sent")
+		return ""
+	}
+}
+
+func TestReverseExecution(t *testing.T) {
+	for _, tt := range []struct {
+		name    string
+		run     func(s *Session)
+		command string
+	}{
+		{"back", func(s *Session) { stepBackCommand(s, nil) }, "stepBack"},
+		{"rc", func(s *Session) { reverseContinueCommand(s, nil) }, "reverseContinue"},
+	} {
+		s, adapter := newFakeSession(t)
+		s.setCapabilities(Capabilities{SupportsStepBack: true})
+		s.setLaunched(LaunchRequestArgs{Program: "./prog"})
+		s.setStopped(1)
+		commands := adapter.serveStepping(tt.command)
+
+		tt.run(s)
+		if command := nextCommandSent(t, commands); command != tt.command {
+			t.Errorf("%s sent %s, want %s", tt.name, command, tt.command)
+		}
+		if _, stopped := s.getCurrentThread(); !stopped {
+			t.Errorf("%s returned before the thread stopped", tt.name)
+		}
+	}
+}
+
+func TestReverseExecutionUnsupported(t *testing.T) {
+	s, adapter := newFakeSession(t)
+	s.setLaunched(LaunchRequestArgs{Program: "./prog"})
+	s.setStopped(1)
+	commands := adapter.serveStepping()
+
+	stepBackCommand(s, nil)
+	reverseContinueCommand(s, nil)
+	select {
+	case command := <-commands:
+		t.Errorf("sent %s to an adapter that can't run backwards", command)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestExceptionStopAsksForInfo(t *testing.T) {
+	s, adapter := newFakeSession(t)
+	captureOutput(s)
+	s.setCapabilities(Capabilities{SupportsExceptionInfoRequest: true})
+	s.setLaunched(LaunchRequestArgs{Program: "./prog"})
+	commands := adapter.serveStepping()
+
+	stopped := s.waitForStop()
+	adapter.sendEvent("stopped", map[string]interface{}{"reason": "exception", "threadId": 1})
+	select {
+	case <-stopped:
+	case <-time.After(time.Second):
+		t.Fatal("stopped event not handled")
+	}
+	var sent []string
+	for len(commands) > 0 {
+		sent = append(sent, <-commands)
+	}
+	if fmt.Sprint(sent) != "[stackTrace exceptionInfo]" {
+		t.Errorf("sent %v, want the stack trace and then exceptionInfo", sent)
+	}
+}
+
+func TestUntilConditionalBreakpoint(t *testing.T) {
+	s, adapter := newFakeSession(t)
+	captureOutput(s)
+	s.setLaunched(LaunchRequestArgs{Program: "./prog"})
+	s.setConfigured()
+	s.setStopped(1)
+	s.addBreakpoint("/src/a.go", SourceBreakpoint{Line: 10, Condition: "x > 5"})
+	var sent []SetBreakpointsArgs
+	go func() {
+		for {
+			req, err := adapter.readRequest()
+			if err != nil {
+				return
+			}
+			var body interface{}
+			switch req.Command {
+			case "setBreakpoints":
+				var args SetBreakpointsArgs
+				json.Unmarshal(req.Arguments, &args)
+				sent = append(sent, args)
+			case "stackTrace":
+				body = map[string]interface{}{"stackFrames": []StackFrame{
+					{ID: 1, Name: "main", Source: &Source{Path: "/src/a.go"}, Line: 10},
+				}}
+			}
+			adapter.respond(req, body)
+			if req.Command == "continue" {
+				adapter.sendEvent("stopped", map[string]interface{}{"reason": "breakpoint", "threadId": 1})
+			}
+		}
+	}()
+
+	untilCommand(s, []string{"/src/a.go:10"})
+	if len(sent) != 2 {
+		t.Fatalf("sent breakpoints %d times, want before and after running", len(sent))
+	}
+	if bps := sent[0].Breakpoints; len(bps) != 1 || bps[0].Line != 10 || bps[0].Condition != "" {
+		t.Errorf("ran with breakpoints %+v, want an unconditional one on line 10", bps)
+	}
+	if bps := sent[1].Breakpoints; len(bps) != 1 || bps[0].Condition != "x > 5" {
+		t.Errorf("left breakpoints %+v, want the user's conditional one back", bps)
+	}
+	if bps := s.getBreakpoints()["/src/a.go"]; len(bps) != 1 || bps[0].Condition != "x > 5" {
+		t.Errorf("breakpoints now %+v, want the user's unchanged", bps)
+	}
+}
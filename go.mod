@@ -0,0 +1,10 @@
+module github.com/dradtke/dap-cli
+
+go 1.23.0
+
+require (
+	github.com/Microsoft/go-winio v0.6.2
+	golang.org/x/term v0.32.0
+)
+
+require golang.org/x/sys v0.33.0 // indirect
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"bufio"
+	"log"
+	"os"
+	"path/filepath"
+)
+
+// maxHistory is the number of commands kept in memory for recall.
+const maxHistory = 1000
+
+// defaultHistoryPath is where command history is persisted between sessions
+// unless --history-file says otherwise.
+func defaultHistoryPath() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".dap-cli_history")
+}
+
+// history is the list of previously entered commands, oldest first.
+type history struct {
+	path    string
+	entries []string
+}
+
+// loadHistory reads the history stored at path. A missing file is not an
+// error, since it will be created when the first command is added.
+func loadHistory(path string) *history {
+	h := &history{path: path}
+	if path == "" {
+		return h
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Printf("failed to read history: %s", err)
+		}
+		return h
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		h.append(scanner.Text())
+	}
+	return h
+}
+
+func (h *history) append(line string) {
+	h.entries = append(h.entries, line)
+	if len(h.entries) > maxHistory {
+		h.entries = h.entries[len(h.entries)-maxHistory:]
+	}
+}
+
+// add records line in the history and appends it to the history file.
+func (h *history) add(line string) {
+	if line == "" || (len(h.entries) > 0 && h.entries[len(h.entries)-1] == line) {
+		return
+	}
+	h.append(line)
+	if h.path == "" {
+		return
+	}
+	f, err := os.OpenFile(h.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		log.Printf("failed to save history: %s", err)
+		return
+	}
+	defer f.Close()
+	if _, err := f.WriteString(line + "\n"); err != nil {
+		log.Printf("failed to save history: %s", err)
+	}
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/term"
+)
+
+// errInterrupted is returned by readLine when the user presses Ctrl-C.
+var errInterrupted = errors.New("interrupted")
+
+// lineReader reads commands from the user.
+type lineReader interface {
+	readLine(prompt string) (string, error)
+}
+
+// completeFunc returns the completion candidates for line with the cursor
+// at pos, and the index from which they replace the line's text.
+type completeFunc func(line []rune, pos int) (start int, candidates []string)
+
+// newLineReader returns a line editor with history recall and completion if
+// stdin is a terminal, and a plain line scanner otherwise.
+func newLineReader(h *history, complete completeFunc) lineReader {
+	if isTerminal(os.Stdin) {
+		return newLineEditor(h, complete)
+	}
+	return &lineScanner{scanner: bufio.NewScanner(os.Stdin)}
+}
+
+type lineScanner struct {
+	scanner *bufio.Scanner
+}
+
+func (s *lineScanner) readLine(prompt string) (string, error) {
+	fmt.Print(prompt)
+	os.Stdout.Sync()
+	if !s.scanner.Scan() {
+		if err := s.scanner.Err(); err != nil {
+			return "", err
+		}
+		return "", io.EOF
+	}
+	return s.scanner.Text(), nil
+}
+
+// lineEditor reads lines with x/term's line editing. The terminal is only
+// in raw mode while a line is being read, so output printed while a command
+// runs is unaffected.
+type lineEditor struct {
+	in       *interruptReader
+	out      io.Writer
+	term     *term.Terminal
+	history  *history
+	complete completeFunc
+}
+
+func newLineEditor(h *history, complete completeFunc) *lineEditor {
+	e := &lineEditor{in: &interruptReader{r: os.Stdin}, out: os.Stdout, history: h, complete: complete}
+	e.reset()
+	return e
+}
+
+// reset starts over with a new terminal, which is the only way to drop a
+// line that was abandoned with Ctrl-C.
+func (e *lineEditor) reset() {
+	e.term = term.NewTerminal(struct {
+		io.Reader
+		io.Writer
+	}{e.in, e.out}, "")
+	e.term.History = termHistory{e.history}
+	e.term.AutoCompleteCallback = e.completeLine
+}
+
+func (e *lineEditor) readLine(prompt string) (string, error) {
+	fd := int(os.Stdin.Fd())
+	state, err := term.MakeRaw(fd)
+	if err != nil {
+		return "", err
+	}
+	defer term.Restore(fd, state)
+
+	e.in.interrupted = false
+	e.term.SetPrompt(prompt)
+	line, err := e.term.ReadLine()
+	if err == io.EOF {
+		// The terminal reports Ctrl-C and Ctrl-D alike.
+		if e.in.interrupted {
+			fmt.Fprint(e.out, "^C\r\n")
+			e.reset()
+			return "", errInterrupted
+		}
+		fmt.Fprint(e.out, "\r\n")
+	}
+	return line, err
+}
+
+// Write prints p without disturbing the line being edited, if there is one.
+// The terminal adds the carriage returns that raw mode needs.
+func (e *lineEditor) Write(p []byte) (int, error) {
+	return e.term.Write(p)
+}
+
+// completeLine is called by the terminal for each key it doesn't handle
+// itself. On Tab it completes the text before the cursor as far as the
+// candidates agree, and lists them if that doesn't get any further.
+func (e *lineEditor) completeLine(line string, pos int, key rune) (string, int, bool) {
+	if key != '\t' || e.complete == nil {
+		return "", 0, false
+	}
+	runes := []rune(line)
+	cursor := utf8.RuneCountInString(line[:pos])
+	start, candidates := e.complete(runes, cursor)
+	if len(candidates) == 0 {
+		return "", 0, false
+	}
+	current := string(runes[start:cursor])
+	prefix := commonPrefix(candidates)
+	if len(candidates) == 1 || (strings.HasPrefix(prefix, current) && prefix != current) {
+		before := string(runes[:start]) + prefix
+		return before + string(runes[cursor:]), len(before), true
+	}
+	e.Write([]byte(strings.Join(candidates, "  ") + "\n"))
+	return "", 0, false
+}
+
+func commonPrefix(ss []string) string {
+	prefix := ss[0]
+	for _, s := range ss[1:] {
+		for !strings.HasPrefix(s, prefix) {
+			_, size := utf8.DecodeLastRuneInString(prefix)
+			prefix = prefix[:len(prefix)-size]
+		}
+	}
+	return prefix
+}
+
+// termHistory lets the terminal recall the history, most recent first.
+// Lines are added by handleInput once they've been run, so the terminal
+// doesn't add them itself.
+type termHistory struct {
+	h *history
+}
+
+func (t termHistory) Add(string) {}
+
+func (t termHistory) Len() int {
+	return len(t.h.entries)
+}
+
+func (t termHistory) At(i int) string {
+	return t.h.entries[len(t.h.entries)-1-i]
+}
+
+// interruptReader notes when Ctrl-C is read, which the terminal otherwise
+// reports as the end of input.
+type interruptReader struct {
+	r           io.Reader
+	interrupted bool
+}
+
+func (r *interruptReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	if bytes.IndexByte(p[:n], 3) >= 0 {
+		r.interrupted = true
+	}
+	return n, err
+}
@@ -1,22 +1,17 @@
 package main
 
 import (
-	"bufio"
-	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
-	"net"
 	"os"
+	"sort"
 	"strconv"
 	"strings"
 	"sync/atomic"
-)
-
-var (
-	seqCounter    int64
-	responseChans = make(map[int64]chan Response)
+	"time"
 )
 
 type ProtocolMessage struct {
@@ -36,25 +31,92 @@ type Response struct {
 	Success    bool            `json:"success"`
 	Command    string          `json:"command"`
 	Message    string          `json:"message"`
-	Body       json.RawMessage `json:"body"`
+	Body       json.RawMessage `json:"body,omitempty"`
+}
+
+type Event struct {
+	ProtocolMessage                 // Type must be "event"
+	Event           string          `json:"event"`
+	Body            json.RawMessage `json:"body"`
+}
+
+type Source struct {
+	Name            string `json:"name,omitempty"`
+	Path            string `json:"path,omitempty"`
+	SourceReference int    `json:"sourceReference,omitempty"`
+}
+
+type OutputEventBody struct {
+	Category string  `json:"category"`
+	Output   string  `json:"output"`
+	Source   *Source `json:"source"`
+	Line     int     `json:"line"`
+}
+
+type ExceptionBreakpointsFilter struct {
+	Filter            string `json:"filter"`
+	Label             string `json:"label"`
+	Description       string `json:"description"`
+	Default           bool   `json:"default"`
+	SupportsCondition bool   `json:"supportsCondition"`
 }
 
 type Capabilities struct {
-	SupportsConfigurationDoneRequest  bool `json:""`
-	SupportsFunctionBreakpoints       bool `json:""`
-	SupportsConditionalBreakpoints    bool `json:""`
-	SupportsHitConditionalBreakpoints bool `json:""`
-	SupportsEvaluateForHovers         bool `json:""`
-	// ExceptionBreakpointFilters        []ExceptionBreakpointsFilter `json:""`
-	SupportsStepBack             bool     `json:""`
-	SupportsSetVariable          bool     `json:""`
-	SupportsRestartFrame         bool     `json:""`
-	SupportsGotoTargetsRequest   bool     `json:""`
-	SupportsStepInTargetsRequest bool     `json:""`
-	SupportsCompletionsRequest   bool     `json:""`
-	CompletionTriggerCharacters  []string `json:""`
-	SupportsModulesRequest       bool     `json:""`
+	SupportsConfigurationDoneRequest   bool                         `json:"supportsConfigurationDoneRequest"`
+	SupportsFunctionBreakpoints        bool                         `json:"supportsFunctionBreakpoints"`
+	SupportsConditionalBreakpoints     bool                         `json:"supportsConditionalBreakpoints"`
+	SupportsHitConditionalBreakpoints  bool                         `json:"supportsHitConditionalBreakpoints"`
+	SupportsEvaluateForHovers          bool                         `json:"supportsEvaluateForHovers"`
+	ExceptionBreakpointFilters         []ExceptionBreakpointsFilter `json:"exceptionBreakpointFilters"`
+	SupportsStepBack                   bool                         `json:"supportsStepBack"`
+	SupportsSetVariable                bool                         `json:"supportsSetVariable"`
+	SupportsRestartFrame               bool                         `json:"supportsRestartFrame"`
+	SupportsGotoTargetsRequest         bool                         `json:"supportsGotoTargetsRequest"`
+	SupportsStepInTargetsRequest       bool                         `json:"supportsStepInTargetsRequest"`
+	SupportsCompletionsRequest         bool                         `json:"supportsCompletionsRequest"`
+	CompletionTriggerCharacters        []string                     `json:"completionTriggerCharacters"`
+	SupportsModulesRequest             bool                         `json:"supportsModulesRequest"`
+	SupportsTerminateRequest           bool                         `json:"supportsTerminateRequest"`
+	SupportsCancelRequest              bool                         `json:"supportsCancelRequest"`
+	SupportsDataBreakpoints            bool                         `json:"supportsDataBreakpoints"`
+	SupportsReadMemoryRequest          bool                         `json:"supportsReadMemoryRequest"`
+	SupportsDisassembleRequest         bool                         `json:"supportsDisassembleRequest"`
+	SupportsExceptionInfoRequest       bool                         `json:"supportsExceptionInfoRequest"`
+	SupportsValueFormattingOptions     bool                         `json:"supportsValueFormattingOptions"`
+	SupportsBreakpointLocationsRequest bool                         `json:"supportsBreakpointLocationsRequest"`
+	SupportsLoadedSourcesRequest       bool                         `json:"supportsLoadedSourcesRequest"`
+	SupportsSetExpression              bool                         `json:"supportsSetExpression"`
+	SupportsWriteMemoryRequest         bool                         `json:"supportsWriteMemoryRequest"`
+	SupportsInstructionBreakpoints     bool                         `json:"supportsInstructionBreakpoints"`
+	SupportsRestartRequest             bool                         `json:"supportsRestartRequest"`
 	// TODO: more
+
+	// Raw holds the capabilities as the adapter reported them, including
+	// the ones the fields above don't cover.
+	Raw map[string]json.RawMessage `json:"-"`
+}
+
+// UnmarshalJSON reads capabilities into c, keeping what's already there,
+// so that it can apply the partial updates of the capabilities event too.
+func (c *Capabilities) UnmarshalJSON(b []byte) error {
+	type capabilities Capabilities
+	if err := json.Unmarshal(b, (*capabilities)(c)); err != nil {
+		return err
+	}
+	var update map[string]json.RawMessage
+	if err := json.Unmarshal(b, &update); err != nil {
+		return err
+	}
+	// Copies of c share Raw, so it's replaced rather than changed.
+	raw := make(map[string]json.RawMessage, len(c.Raw)+len(update))
+	for k, v := range c.Raw {
+		raw[k] = v
+	}
+	for k, v := range update {
+		raw[k] = v
+	}
+	c.Raw = raw
+	return nil
 }
 
 type InitializeRequestArgs struct {
@@ -62,14 +124,39 @@ type InitializeRequestArgs struct {
 	ClientName string `json:"clientName,omitempty"`
 	AdapterID  string `json:"adapterID"`
 	Locale     string `json:"locale,omitempty"`
-	// TODO: figure out how to handle these bools
-	// LinesStartAt1   bool   `json:"linesStartAt1,omitempty"`
-	// ColumnsStartAt1 bool   `json:"columnsStartAt1,omitempty"`
-	// also add the rest
+	// LinesStartAt1 and ColumnsStartAt1 are always sent, since the
+	// protocol treats a missing value as true.
+	LinesStartAt1   bool `json:"linesStartAt1"`
+	ColumnsStartAt1 bool `json:"columnsStartAt1"`
+	// PathFormat is either "path" or "uri".
+	PathFormat                string `json:"pathFormat,omitempty"`
+	SupportsProgressReporting bool   `json:"supportsProgressReporting,omitempty"`
+	SupportsRunInTerminal     bool   `json:"supportsRunInTerminalRequest,omitempty"`
+	// TODO: add the rest
 }
 
+// displayLine converts a line number from the adapter to the 1-based
+// numbering shown to the user.
+func displayLine(s *Session, line int) int {
+	if s.opts.InitializeArgs.LinesStartAt1 {
+		return line
+	}
+	return line + 1
+}
+
+// protocolLine converts a 1-based line number from the user to the
+// numbering the client asked the adapter to use.
+func protocolLine(s *Session, line int) int {
+	if s.opts.InitializeArgs.LinesStartAt1 {
+		return line
+	}
+	return line - 1
+}
+
+// NewRequest returns the header for a request. Its seq is assigned when
+// the request is sent.
 func NewRequest() ProtocolMessage {
-	return ProtocolMessage{Seq: atomic.AddInt64(&seqCounter, 1), Type: "request"}
+	return ProtocolMessage{Type: "request"}
 }
 
 func InitializeRequest(args InitializeRequestArgs) Request {
@@ -80,112 +167,818 @@ func InitializeRequest(args InitializeRequestArgs) Request {
 	}
 }
 
-func listen(c net.Conn) {
-	r := bufio.NewReader(c)
-	for {
-		headers := make(map[string]string)
-		for {
-			// Technically we need to look for \r\n, but this should catch the \r too, we just need to trim it off.
-			data, err := r.ReadBytes('\n')
-			if err != nil {
-				if err == io.EOF {
-					return
-				}
-				log.Fatalf("failed to read line: %s", err)
-			}
-			line := string(bytes.TrimSpace(data))
-			if len(line) == 0 {
-				break
+type LaunchRequestArgs struct {
+	NoDebug bool              `json:"noDebug,omitempty"`
+	Program string            `json:"program,omitempty"`
+	Args    []string          `json:"args,omitempty"`
+	Cwd     string            `json:"cwd,omitempty"`
+	Env     map[string]string `json:"env,omitempty"`
+	// Raw holds adapter-specific arguments, which are merged in alongside
+	// the common fields above.
+	Raw map[string]interface{} `json:"-"`
+}
+
+func (args LaunchRequestArgs) MarshalJSON() ([]byte, error) {
+	type launchRequestArgs LaunchRequestArgs
+	return marshalWithRaw(launchRequestArgs(args), args.Raw)
+}
+
+func LaunchRequest(args LaunchRequestArgs) Request {
+	return Request{
+		ProtocolMessage: NewRequest(),
+		Command:         "launch",
+		Arguments:       args,
+	}
+}
+
+type AttachRequestArgs struct {
+	ProcessID int    `json:"processId,omitempty"`
+	Host      string `json:"host,omitempty"`
+	Port      int    `json:"port,omitempty"`
+	// Raw holds adapter-specific arguments, which are merged in alongside
+	// the common fields above.
+	Raw map[string]interface{} `json:"-"`
+}
+
+func (args AttachRequestArgs) MarshalJSON() ([]byte, error) {
+	type attachRequestArgs AttachRequestArgs
+	return marshalWithRaw(attachRequestArgs(args), args.Raw)
+}
+
+func AttachRequest(args AttachRequestArgs) Request {
+	return Request{
+		ProtocolMessage: NewRequest(),
+		Command:         "attach",
+		Arguments:       args,
+	}
+}
+
+func ConfigurationDoneRequest() Request {
+	return Request{
+		ProtocolMessage: NewRequest(),
+		Command:         "configurationDone",
+	}
+}
+
+type DisconnectArgs struct {
+	Restart           bool `json:"restart,omitempty"`
+	TerminateDebuggee bool `json:"terminateDebuggee"`
+}
+
+func DisconnectRequest(args DisconnectArgs) Request {
+	return Request{
+		ProtocolMessage: NewRequest(),
+		Command:         "disconnect",
+		Arguments:       args,
+	}
+}
+
+type TerminateArgs struct {
+	Restart bool `json:"restart,omitempty"`
+}
+
+func TerminateRequest(args TerminateArgs) Request {
+	return Request{
+		ProtocolMessage: NewRequest(),
+		Command:         "terminate",
+		Arguments:       args,
+	}
+}
+
+// marshalWithRaw marshals v as a JSON object and merges the keys from raw
+// into it. Keys set by v take precedence over those in raw.
+func marshalWithRaw(v interface{}, raw map[string]interface{}) ([]byte, error) {
+	b, err := json.Marshal(v)
+	if err != nil || len(raw) == 0 {
+		return b, err
+	}
+	var known map[string]json.RawMessage
+	if err := json.Unmarshal(b, &known); err != nil {
+		return nil, err
+	}
+	fields := make(map[string]interface{}, len(raw)+len(known))
+	for k, v := range raw {
+		fields[k] = v
+	}
+	for k, v := range known {
+		fields[k] = v
+	}
+	return json.Marshal(fields)
+}
+
+func handleEvent(s *Session, event Event) {
+	if !noDebugEvents[event.Event] && isNoDebug(s) {
+		s.notifyEvent(event.Event)
+		return
+	}
+	if s.opts.JSON {
+		printJSON(s, EventResult{Event: event.Event, Body: event.Body})
+	}
+	switch event.Event {
+	case "initialized":
+		// Breakpoints added from here on are sent right away, so none can
+		// be missed by the configuration sequence. That has to run on its
+		// own goroutine, since this one must stay free to read the
+		// responses it waits for.
+		s.setConfigured()
+		go func() {
+			// Adapters often send this event right behind the initialize
+			// response, before initialize has stored the capabilities the
+			// configuration sequence depends on.
+			select {
+			case <-s.waitForCapabilities():
+			case <-time.After(s.Timeout):
+				printError(s, "initialized before the initialize request finished; configuring anyway")
 			}
-			parts := strings.Split(line, ":")
-			headers[strings.TrimSpace(parts[0])] = strings.TrimSpace(parts[1])
+			configurationSequence(s)
+		}()
+	case "stopped":
+		// handleStopped notifies waiters itself, once it has reported
+		// where the thread stopped.
+		handleStopped(s, event)
+		return
+	case "output":
+		// In JSON mode, the event itself is the output.
+		if !s.opts.JSON {
+			handleOutput(s, event)
 		}
+	case "exited":
+		handleExited(s, event)
+	case "terminated":
+		handleTerminated(s, event)
+	case "module":
+		handleModuleEvent(s, event)
+	case "loadedSource":
+		handleLoadedSourceEvent(s, event)
+	case "capabilities":
+		handleCapabilitiesEvent(s, event)
+	case "breakpoint":
+		handleBreakpointEvent(s, event)
+	case "thread":
+		handleThreadEvent(s, event)
+	case "progressStart", "progressUpdate", "progressEnd":
+		handleProgressEvent(s, event)
+	default:
+		if !s.opts.JSON {
+			fmt.Fprintf(s.opts.Out, "event: %s %s\n", colorize(colorCyan, event.Event), event.Body)
+		}
+	}
+	s.notifyEvent(event.Event)
+}
 
-		if headers["Content-Length"] == "" {
-			log.Printf("warning: no Content-Length header")
-			continue
+// ExitedEventBody is the body of the exited event.
+type ExitedEventBody struct {
+	ExitCode int `json:"exitCode"`
+}
+
+// TerminatedEventBody is the body of the terminated event. Restart is set
+// when the adapter wants the session restarted, and is passed back to it
+// as the __restart launch argument.
+type TerminatedEventBody struct {
+	Restart json.RawMessage `json:"restart,omitempty"`
+}
+
+func handleExited(s *Session, event Event) {
+	var body ExitedEventBody
+	if err := json.Unmarshal(event.Body, &body); err != nil {
+		log.Printf("failed to read exited event: %s", err)
+		return
+	}
+	fmt.Fprintf(s.opts.Out, "program exited with code %d\n", body.ExitCode)
+}
+
+func handleTerminated(s *Session, event Event) {
+	var body TerminatedEventBody
+	if len(event.Body) > 0 {
+		if err := json.Unmarshal(event.Body, &body); err != nil {
+			log.Printf("failed to read terminated event: %s", err)
+		}
+	}
+	args, launched := s.setTerminated()
+	fmt.Fprintln(s.opts.Out, "session terminated")
+	restart := len(body.Restart) > 0 && string(body.Restart) != "false" && string(body.Restart) != "null"
+	if !restart || !launched {
+		return
+	}
+	if !s.opts.AutoRestart {
+		fmt.Fprintln(s.opts.Out, "the adapter asked for a restart; run with --auto-restart to relaunch automatically")
+		return
+	}
+	raw := map[string]interface{}{"__restart": body.Restart}
+	for k, v := range args.Raw {
+		raw[k] = v
+	}
+	args.Raw = raw
+	// Like the configuration sequence, this waits for a response, so it
+	// can't run on the listen goroutine.
+	go func() {
+		fmt.Fprintf(s.opts.Out, "restarting %s\n", args.Program)
+		if _, err := sendInitialize(s); err != nil {
+			printError(s, "restart failed: %s", err)
+			return
+		}
+		if err := launchSession(s, args); err != nil {
+			printError(s, "restart failed: %s", err)
 		}
+	}()
+}
 
-		contentLength, err := strconv.Atoi(headers["Content-Length"])
-		if err != nil {
-			log.Fatalf("bad Content-Length: %s", err)
+// CapabilitiesEventBody is the body of the capabilities event. Capabilities
+// holds only the capabilities that changed.
+type CapabilitiesEventBody struct {
+	Capabilities json.RawMessage `json:"capabilities"`
+}
+
+func handleCapabilitiesEvent(s *Session, event Event) {
+	var body CapabilitiesEventBody
+	if err := json.Unmarshal(event.Body, &body); err != nil {
+		log.Printf("failed to read capabilities event: %s", err)
+		return
+	}
+	if len(body.Capabilities) == 0 {
+		return
+	}
+	if err := s.mergeCapabilities(body.Capabilities); err != nil {
+		log.Printf("failed to read capabilities event: %s", err)
+	}
+}
+
+func handleOutput(s *Session, event Event) {
+	var body OutputEventBody
+	if err := json.Unmarshal(event.Body, &body); err != nil {
+		log.Printf("failed to read output event: %s", err)
+		return
+	}
+	switch body.Category {
+	case "stderr":
+		fmt.Fprint(os.Stderr, colorize(colorRed, body.Output))
+	case "telemetry":
+		// not meant for the user
+	default:
+		// stdout, console, and anything else
+		fmt.Fprint(s.opts.Out, body.Output)
+	}
+}
+
+// sendAndWait sends req over s and waits for its response. Requests the
+// adapter doesn't support are refused without being sent.
+func sendAndWait(s *Session, req Request) (Response, error) {
+	if err := checkSupported(s, req.Command); err != nil {
+		return Response{}, err
+	}
+	return s.SendAndWait(req)
+}
+
+func initialize(s *Session) Capabilities {
+	caps, err := sendInitialize(s)
+	if err != nil {
+		log.Fatal(err)
+	}
+	for _, filter := range caps.ExceptionBreakpointFilters {
+		if filter.Default {
+			s.toggleExceptionFilter(filter.Filter)
 		}
+	}
+	return caps
+}
 
-		body := make([]byte, contentLength)
-		if _, err := io.ReadFull(r, body); err != nil {
-			if err == io.EOF {
-				return
-			}
-			log.Fatalf("failed to read body: %s", err)
+// sendInitialize sends the initialize request and records the adapter's
+// capabilities. A debuggee launched again after terminating needs it sent
+// again first, since to the adapter that is a new session.
+func sendInitialize(s *Session) (Capabilities, error) {
+	s.setInitializing()
+	caps, err := s.Initialize(s.opts.InitializeArgs)
+	if err != nil {
+		return caps, err
+	}
+	s.setCapabilities(caps)
+	return caps, nil
+}
+
+// configurationSequence runs when the adapter sends the initialized event,
+// and is responsible for configuring the session before execution begins.
+var configurationSequence = func(s *Session) {
+	if isNoDebug(s) {
+		// There's nothing to configure if nothing will stop.
+		if err := configurationDone(s); err != nil {
+			printError(s, "%s", err)
+		}
+		return
+	}
+	// Breakpoints can be added before the session starts, so this is where
+	// they're first sent. Files go in order so the replay is predictable.
+	// A step that fails doesn't stop the rest from being tried.
+	bps := s.getBreakpoints()
+	paths := make([]string, 0, len(bps))
+	for path := range bps {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		if err := setBreakpoints(s, path, bps[path]); err != nil {
+			printError(s, "%s", err)
+		}
+	}
+	if bps := s.getFunctionBreakpoints(); len(bps) > 0 {
+		if err := setFunctionBreakpoints(s, bps); err != nil {
+			printError(s, "%s", err)
+		}
+	}
+	if len(s.getCapabilities().ExceptionBreakpointFilters) > 0 {
+		if err := setExceptionBreakpoints(s, s.getExceptionFilters()); err != nil {
+			printError(s, "%s", err)
 		}
+	}
+	if err := configurationDone(s); err != nil {
+		printError(s, "%s", err)
+	}
+}
 
-		var resp Response
-		if err := json.Unmarshal(body, &resp); err != nil {
-			log.Fatalf("failed to unmarshal response body")
+// configurationDone tells the adapter that the client has finished
+// configuring the session, if the adapter wants to be told.
+func configurationDone(s *Session) error {
+	if checkSupported(s, "configurationDone") != nil {
+		return nil
+	}
+	req := ConfigurationDoneRequest()
+	_, err := sendAndWait(s, req)
+	return err
+}
+
+func launch(s *Session, args []string) error {
+	if len(args) == 0 {
+		return errors.New("usage: launch <program> [args...]")
+	}
+	launchArgs := LaunchRequestArgs{Program: args[0], Args: args[1:]}
+	if cfg, ok := s.opts.findConfig(args[0]); ok {
+		if cfg.Request != "launch" {
+			return fmt.Errorf("%s is an attach configuration; use attach %s", cfg.Name, cfg.Name)
+		}
+		// The configuration was validated when it was loaded.
+		launchArgs, _ = cfg.resolved(newVarContext(s)).launchArgs()
+		if len(args) > 1 {
+			launchArgs.Args = args[1:]
 		}
+	}
+	return launchSession(s, launchArgs)
+}
 
-		if ch, ok := responseChans[resp.RequestSeq]; ok {
-			ch <- resp
-			close(ch)
-			delete(responseChans, resp.RequestSeq)
+// launchSession launches the debuggee and remembers the arguments, so the
+// session can be launched again after it terminates.
+func launchSession(s *Session, args LaunchRequestArgs) error {
+	if s.opts.NoDebug {
+		args.NoDebug = true
+	}
+	// The adapter gets the final say, so these are only warnings.
+	for _, warning := range checkLaunchArgs(s.opts.InitializeArgs.AdapterID, args) {
+		fmt.Fprintln(s.opts.Out, "warning: "+warning)
+	}
+	if _, err := sendAndWait(s, LaunchRequest(args)); err != nil {
+		return err
+	}
+	s.setLaunched(args)
+	return nil
+}
+
+func attach(s *Session, args []string) error {
+	if len(args) == 0 {
+		return errors.New("usage: attach pid=<pid> | attach host=<host> port=<port> [key=value...]")
+	}
+	var attachArgs AttachRequestArgs
+	if cfg, ok := s.opts.findConfig(args[0]); ok {
+		if cfg.Request != "attach" {
+			return fmt.Errorf("%s is a launch configuration; use launch %s", cfg.Name, cfg.Name)
+		}
+		attachArgs, _ = cfg.resolved(newVarContext(s)).attachArgs()
+		args = args[1:]
+	}
+	for _, arg := range args {
+		parts := strings.SplitN(arg, "=", 2)
+		if len(parts) != 2 {
+			return fmt.Errorf("bad argument %q: expected key=value", arg)
+		}
+		key, value := parts[0], parts[1]
+		switch key {
+		case "pid":
+			pid, err := strconv.Atoi(value)
+			if err != nil {
+				return fmt.Errorf("bad pid: %s", err)
+			}
+			attachArgs.ProcessID = pid
+		case "host":
+			attachArgs.Host = value
+		case "port":
+			port, err := strconv.Atoi(value)
+			if err != nil {
+				return fmt.Errorf("bad port: %s", err)
+			}
+			attachArgs.Port = port
+		default:
+			if attachArgs.Raw == nil {
+				attachArgs.Raw = make(map[string]interface{})
+			}
+			attachArgs.Raw[key] = value
 		}
-		// do anything if there is no response channel?
 	}
+	if err := attachSession(s, attachArgs); err != nil {
+		return err
+	}
+	fmt.Fprintln(s.opts.Out, "attached")
+	return nil
+}
+
+func attachSession(s *Session, args AttachRequestArgs) error {
+	if _, err := sendAndWait(s, AttachRequest(args)); err != nil {
+		return err
+	}
+	s.setAttached(args)
+	return nil
 }
 
-func sendMessage(c net.Conn, msg interface{}) {
-	b, err := json.Marshal(msg)
+// startConfig launches or attaches as described by the named configuration.
+func startConfig(s *Session, name string) error {
+	cfg, _ := s.opts.findConfig(name)
+	switch cfg.Request {
+	case "launch":
+		return launch(s, []string{cfg.Name})
+	case "attach":
+		return attach(s, []string{cfg.Name})
+	}
+	return nil
+}
+
+// disconnectSession ends the session and closes the connection.
+func disconnectSession(s *Session, terminateDebuggee bool) error {
+	// Mark the session disconnected first, since the adapter may close the
+	// connection before its response has been handled. The connection is
+	// closed even if the adapter objects.
+	s.setDisconnected()
+	req := DisconnectRequest(DisconnectArgs{TerminateDebuggee: terminateDebuggee})
+	_, err := sendAndWait(s, req)
+	s.Close()
+	return err
+}
+
+// disconnect ends the session. Launched debuggees are terminated, while
+// attached ones are left running.
+func disconnect(s *Session, args []string) error {
+	return disconnectSession(s, s.getMode() == modeLaunch)
+}
+
+// terminate asks the debuggee to shut down gracefully, and then ends the
+// session. Adapters that can't do that have the debuggee terminated by
+// disconnecting instead.
+func terminate(s *Session, args []string) error {
+	if checkSupported(s, "terminate") != nil {
+		return disconnectSession(s, true)
+	}
+	terminated := s.waitForEvent("terminated")
+	if _, err := sendAndWait(s, TerminateRequest(TerminateArgs{})); err != nil {
+		return err
+	}
+	select {
+	case <-terminated:
+	case <-time.After(s.Timeout):
+		// The session is ended regardless.
+		disconnectSession(s, true)
+		return fmt.Errorf("debuggee did not terminate after %s", s.Timeout)
+	}
+	return disconnectSession(s, true)
+}
+
+// quit ends the session, preferring terminate for launched debuggees so
+// they get a chance to clean up.
+func quit(s *Session, args []string) error {
+	if s.getMode() == modeLaunch {
+		return terminate(s, args)
+	}
+	return disconnect(s, args)
+}
+
+// rawCommand sends an arbitrary request and prints the full response, which
+// is useful for exploring requests that don't have a command of their own.
+func rawCommand(s *Session, args []string) error {
+	if len(args) == 0 {
+		return errors.New("usage: raw <command> [json-args]")
+	}
+	req := Request{
+		ProtocolMessage: NewRequest(),
+		Command:         args[0],
+	}
+	if len(args) > 1 {
+		arguments := json.RawMessage(strings.Join(args[1:], " "))
+		if !json.Valid(arguments) {
+			var v interface{}
+			return fmt.Errorf("bad arguments: %s", json.Unmarshal(arguments, &v))
+		}
+		req.Arguments = arguments
+	}
+	resp, err := sendAndWait(s, req)
+	if err != nil && resp.Type == "" {
+		// No response arrived at all. Unsuccessful responses are still
+		// worth printing in full.
+		return err
+	}
+	b, err := json.MarshalIndent(resp, "", "  ")
 	if err != nil {
-		log.Printf("failed to send message: %s", err)
-		return
+		return fmt.Errorf("failed to format response: %s", err)
 	}
-	fmt.Fprintf(c, "Content-Length: %d\r\n", len(b))
-	fmt.Fprint(c, "\r\n")
-	c.Write(b)
+	fmt.Fprintln(s.opts.Out, string(b))
+	return nil
 }
 
-func initialize(c net.Conn) Capabilities {
-	req := InitializeRequest(InitializeRequestArgs{
-		AdapterID: "dap-cli",
-	})
-	responseChans[req.Seq] = make(chan Response)
-	sendMessage(c, req)
-	resp := <-responseChans[req.Seq]
-	if !resp.Success {
-		log.Println(resp)
-		log.Fatal("initialization failed")
+// input reads the user's commands. Commands that need to ask the user
+// something, like choose, read the answer from it too.
+var input lineReader
+
+// choose asks the user to pick one of options, and returns its index.
+func choose(s *Session, options []string) (int, error) {
+	for i, option := range options {
+		fmt.Fprintf(s.opts.Out, "%d: %s\n", i+1, option)
+	}
+	answer, err := input.readLine(fmt.Sprintf("choose 1-%d: ", len(options)))
+	if err != nil {
+		return 0, err
 	}
-	var caps Capabilities
-	if err := json.Unmarshal(resp.Body, &caps); err != nil {
-		log.Fatalf("failed to read capabilities: %s", err)
+	n, err := strconv.Atoi(strings.TrimSpace(answer))
+	if err != nil || n < 1 || n > len(options) {
+		return 0, fmt.Errorf("bad choice %q", strings.TrimSpace(answer))
 	}
-	return caps
+	return n - 1, nil
+}
+
+// startInput sets up input to read the user's commands, and returns the
+// history they're added to. It has to be called before anything is
+// reported to opts.Out, which the line editor may take over.
+func startInput(opts *Options) *history {
+	h := loadHistory(opts.HistoryPath)
+	input = newLineReader(h, completer())
+	if e, ok := input.(*lineEditor); ok && !opts.JSON {
+		// Events reported while a line is being edited would otherwise
+		// garble it.
+		opts.Out = e
+	}
+	return h
 }
 
-func handleInput() {
-	scanner := bufio.NewScanner(os.Stdin)
+func handleInput(opts *Options, h *history) {
+	prompt := colorize(colorGreen, "> ")
+	if opts.JSON {
+		prompt = ""
+	}
 	for {
-		fmt.Print("> ")
-		os.Stdout.Sync()
-		if !scanner.Scan() {
-			break
+		line, err := input.readLine(prompt)
+		if err == errInterrupted {
+			continue
+		}
+		if err != nil {
+			if err != io.EOF {
+				log.Printf("input exited with error: %s", err)
+			}
+			return
+		}
+		h.add(strings.TrimSpace(line))
+		// Commands go to whichever session is current when they're run.
+		s := currentSession()
+		if strings.TrimSpace(line) == "" {
+			line = repeatCommand(s)
+		}
+		rememberCommand(s, line)
+		handleCommand(s, line)
+		if s.isDisconnected() {
+			return
 		}
-		// TODO: process scanner.Text()
 	}
-	if err := scanner.Err(); err != nil {
-		log.Printf("input scanner exited with error: %s", err)
+}
+
+// options are the command-line options that may precede the transport
+// arguments. Each one takes a value.
+var options = map[string]func(o *Options, value string) error{
+	"--timeout": func(o *Options, value string) error {
+		timeout, err := time.ParseDuration(value)
+		if err != nil {
+			return err
+		}
+		o.Timeout = timeout
+		return nil
+	},
+	"--connect-retries": func(o *Options, value string) error {
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return err
+		}
+		if n < 0 {
+			return errors.New("must not be negative")
+		}
+		o.ConnectRetries = n
+		return nil
+	},
+	"--connect-interval": func(o *Options, value string) error {
+		interval, err := time.ParseDuration(value)
+		if err != nil {
+			return err
+		}
+		o.ConnectInterval = interval
+		return nil
+	},
+	"--color": func(o *Options, value string) error {
+		return setColorMode(value)
+	},
+	"--output": setOutputMode,
+	"--log-file": func(o *Options, value string) error {
+		return openTrafficLog(value)
+	},
+	"--config": func(o *Options, value string) error {
+		o.ConfigPath = value
+		return nil
+	},
+	"--adapter-id": func(o *Options, value string) error {
+		o.AdapterID = value
+		return nil
+	},
+	"--config-name": func(o *Options, value string) error {
+		o.ConfigName = value
+		return nil
+	},
+	"--script": func(o *Options, value string) error {
+		o.ScriptPath = value
+		return nil
+	},
+	"--history-file": func(o *Options, value string) error {
+		o.HistoryPath = value
+		return nil
+	},
+}
+
+// flags are the command-line options that don't take a value, and return
+// the option each one sets.
+var flags = map[string]func(o *Options) *bool{
+	"--auto-restart":  func(o *Options) *bool { return &o.AutoRestart },
+	"--no-debug":      func(o *Options) *bool { return &o.NoDebug },
+	"--stop-on-error": func(o *Options) *bool { return &o.StopOnError },
+	"--no-auto-stack": func(o *Options) *bool { return &o.NoAutoStack },
+	"--version":       func(o *Options) *bool { return &o.ShowVersion },
+	"--dry-run":       func(o *Options) *bool { return &o.DryRun },
+}
+
+// errHelp is returned by parseOptions when asked for the usage.
+var errHelp = errors.New("help requested")
+
+// parseOptions applies the options that precede the transport arguments to
+// o, and returns the remaining arguments.
+func parseOptions(o *Options, args []string) ([]string, error) {
+	for len(args) > 0 {
+		if flag, ok := flags[args[0]]; ok {
+			*flag(o) = true
+			args = args[1:]
+			continue
+		}
+		if args[0] == "-h" || args[0] == "--help" {
+			return nil, errHelp
+		}
+		name, value, hasValue := strings.Cut(args[0], "=")
+		apply, ok := options[name]
+		if !ok && strings.HasPrefix(name, "-") && !transportFlags[name] {
+			return nil, fmt.Errorf("unknown option %s", name)
+		}
+		if !ok {
+			break
+		}
+		args = args[1:]
+		if !hasValue {
+			if len(args) == 0 {
+				return nil, fmt.Errorf("%s requires a value", name)
+			}
+			value, args = args[0], args[1:]
+		}
+		if err := apply(o, value); err != nil {
+			return nil, fmt.Errorf("bad %s: %s", name, err)
+		}
 	}
+	return args, nil
 }
 
 func main() {
-	addr := os.Args[1]
-	conn, err := net.Dial("tcp", addr)
+	if err := setColorMode("auto"); err != nil {
+		log.Fatal(err)
+	}
+	opts := newOptions()
+	args, err := parseOptions(opts, os.Args[1:])
+	if errors.Is(err, errHelp) {
+		fmt.Println(usage)
+		return
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n%s\n", err, usage)
+		os.Exit(2)
+	}
+	if opts.ShowVersion {
+		printVersion(opts)
+		return
+	}
+	if opts.JSON {
+		useColor = false
+	}
+	if opts.Config, err = loadConfig(opts.ConfigPath); err != nil {
+		log.Fatal(err)
+	}
+	opts.StepIntoFilter = opts.Config.StepIntoFilter
+	if opts.ConfigName != "" {
+		cfg, ok := opts.findConfig(opts.ConfigName)
+		if !ok {
+			log.Fatalf("no configuration named %q in %s", opts.ConfigName, opts.ConfigPath)
+		}
+		// Transport arguments on the command line override the config.
+		if len(args) == 0 {
+			args = cfg.Adapter.transportArgs()
+		}
+		if opts.AdapterID == "" {
+			opts.AdapterID = cfg.Adapter.ID
+		}
+	}
+	if opts.AdapterID != "" {
+		opts.InitializeArgs.AdapterID = opts.AdapterID
+	}
+	var transport io.ReadWriteCloser = dryRunConn{}
+	if !opts.DryRun {
+		transport, err = openTransport(opts, args)
+	}
+	if errors.Is(err, errUsage) {
+		fmt.Fprintln(os.Stderr, usage)
+		os.Exit(2)
+	}
 	if err != nil {
-		log.Fatalf("failed to dial %s: %s", addr, err)
+		log.Fatal(err)
+	}
+	script, err := openScript(opts)
+	if err != nil {
+		log.Fatal(err)
+	}
+	var h *history
+	if script == nil {
+		h = startInput(opts)
+	}
+
+	cl := NewClient(transport)
+	cl.Timeout = opts.Timeout
+	conn := newSession(cl, opts)
+	defer conn.Close()
+	if opts.DryRun {
+		cl.DryRun = func(req Request) { printRequest(conn, req) }
+	} else {
+		conn.reconnect = func() (io.ReadWriteCloser, error) { return openTransport(opts, args) }
+	}
+
+	sessionDone := make(chan error, 1)
+	if !opts.DryRun {
+		go func() {
+			sessionDone <- conn.Listen(conn)
+		}()
 	}
-	go listen(conn)
 	caps := initialize(conn)
-	fmt.Printf("capabilities: %+v\n", caps)
+	if opts.DryRun {
+		startDryRun(conn)
+	}
+	fmt.Fprintln(opts.Out, capabilitiesSummary(caps))
+	if len(caps.ExceptionBreakpointFilters) > 0 && !opts.JSON {
+		fmt.Fprintln(opts.Out, "exception filters (toggle with catch <filter>):")
+		printExceptionFilters(conn, caps.ExceptionBreakpointFilters)
+	}
+
+	if opts.ConfigName != "" {
+		if err := startConfig(conn, opts.ConfigName); err != nil {
+			printError(conn, "%s", err)
+		}
+	}
 
-	handleInput()
+	go handleInterrupts(conn)
+	var scriptFailed int32
+	inputDone := make(chan struct{})
+	go func() {
+		defer close(inputDone)
+		if script == nil {
+			handleInput(opts, h)
+			return
+		}
+		defer script.Close()
+		if !runScript(opts, script) {
+			atomic.StoreInt32(&scriptFailed, 1)
+		}
+	}()
+
+	select {
+	case err := <-sessionDone:
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Fprintln(opts.Out, "\nsession ended")
+		if conn.isDisconnected() {
+			// The input loop asked for this, and is about to return.
+			<-inputDone
+		}
+	case <-inputDone:
+	}
+	if atomic.LoadInt32(&scriptFailed) != 0 {
+		os.Exit(1)
+	}
 }
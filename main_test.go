@@ -0,0 +1,299 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+)
+
+// newFakeSession returns a session with a fake adapter, listening for the
+// adapter's messages until the test ends. It isn't added to sessions.
+func newFakeSession(t *testing.T) (*Session, *fakeAdapter) {
+	cl, adapter := newFakeAdapter(t)
+	cl.Timeout = time.Second
+	s := &Session{Client: cl, sessionState: newSessionState(), opts: newOptions()}
+	listen(t, cl, s)
+	return s, adapter
+}
+
+// readRequests reads the requests the client sends until none has arrived
+// for a while.
+func (a *fakeAdapter) readRequests(answer func(req fakeRequest) interface{}) []fakeRequest {
+	var reqs []fakeRequest
+	for {
+		a.conn.SetReadDeadline(time.Now().Add(200 * time.Millisecond))
+		req, err := a.readRequest()
+		if err != nil {
+			return reqs
+		}
+		reqs = append(reqs, req)
+		a.respond(req, answer(req))
+	}
+}
+
+func commandsOf(reqs []fakeRequest) []string {
+	var names []string
+	for _, req := range reqs {
+		names = append(names, req.Command)
+	}
+	return names
+}
+
+func TestInitializedRightAfterInitialize(t *testing.T) {
+	s, adapter := newFakeSession(t)
+	go func() {
+		req, err := adapter.readRequest()
+		if err != nil {
+			return
+		}
+		adapter.respond(req, Capabilities{SupportsConfigurationDoneRequest: true})
+		adapter.sendEvent("initialized", nil)
+	}()
+	initialize(s)
+
+	reqs := adapter.readRequests(func(req fakeRequest) interface{} { return nil })
+	done := 0
+	for _, req := range reqs {
+		if req.Command == "configurationDone" {
+			done++
+		}
+	}
+	if done != 1 {
+		t.Errorf("configurationDone sent %d times, want once; requests were %v", done, commandsOf(reqs))
+	}
+}
+
+func TestInitializedSendsConfiguration(t *testing.T) {
+	s, adapter := newFakeSession(t)
+	s.setCapabilities(Capabilities{SupportsConfigurationDoneRequest: true})
+	s.addBreakpoint("/src/b.go", SourceBreakpoint{Line: 7})
+	s.addBreakpoint("/src/a.go", SourceBreakpoint{Line: 3})
+	go adapter.sendEvent("initialized", nil)
+
+	reqs := adapter.readRequests(func(req fakeRequest) interface{} { return nil })
+	got := commandsOf(reqs)
+	want := []string{"setBreakpoints", "setBreakpoints", "configurationDone"}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Fatalf("sent %v, want %v", got, want)
+	}
+	// Files go in order.
+	var args SetBreakpointsArgs
+	json.Unmarshal(reqs[0].Arguments, &args)
+	if args.Source.Path != "/src/a.go" {
+		t.Errorf("first breakpoints sent for %s, want /src/a.go", args.Source.Path)
+	}
+	if !s.isConfigured() {
+		t.Error("session not configured after the initialized event")
+	}
+}
+
+func TestCapabilitiesFromAdapter(t *testing.T) {
+	// Part of what a real adapter sends in its initialize response.
+	body := `{
+		"supportsConfigurationDoneRequest": true,
+		"supportsFunctionBreakpoints": true,
+		"supportsConditionalBreakpoints": true,
+		"supportsEvaluateForHovers": true,
+		"supportsTerminateRequest": true,
+		"supportsCancelRequest": true,
+		"supportsDataBreakpoints": true,
+		"supportsReadMemoryRequest": true,
+		"supportsDisassembleRequest": true,
+		"supportsExceptionInfoRequest": true,
+		"supportsValueFormattingOptions": true,
+		"supportTerminateDebuggee": true
+	}`
+	var caps Capabilities
+	if err := json.Unmarshal([]byte(body), &caps); err != nil {
+		t.Fatal(err)
+	}
+	for name, ok := range map[string]bool{
+		"supportsConfigurationDoneRequest": caps.SupportsConfigurationDoneRequest,
+		"supportsFunctionBreakpoints":      caps.SupportsFunctionBreakpoints,
+		"supportsConditionalBreakpoints":   caps.SupportsConditionalBreakpoints,
+		"supportsEvaluateForHovers":        caps.SupportsEvaluateForHovers,
+		"supportsTerminateRequest":         caps.SupportsTerminateRequest,
+		"supportsCancelRequest":            caps.SupportsCancelRequest,
+		"supportsDataBreakpoints":          caps.SupportsDataBreakpoints,
+		"supportsReadMemoryRequest":        caps.SupportsReadMemoryRequest,
+		"supportsDisassembleRequest":       caps.SupportsDisassembleRequest,
+		"supportsExceptionInfoRequest":     caps.SupportsExceptionInfoRequest,
+		"supportsValueFormattingOptions":   caps.SupportsValueFormattingOptions,
+	} {
+		if !ok {
+			t.Errorf("%s not read", name)
+		}
+	}
+	if caps.SupportsStepBack {
+		t.Error("supportsStepBack set, but the adapter didn't send it")
+	}
+}
+
+func TestInitializeArgsKeys(t *testing.T) {
+	b, err := json.Marshal(newOptions().InitializeArgs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var sent map[string]interface{}
+	json.Unmarshal(b, &sent)
+	for key, want := range map[string]interface{}{
+		"linesStartAt1":   true,
+		"columnsStartAt1": true,
+		"pathFormat":      "path",
+	} {
+		if sent[key] != want {
+			t.Errorf("%s = %v, want %v, in %s", key, sent[key], want, b)
+		}
+	}
+}
+
+func TestZeroBasedLines(t *testing.T) {
+	s := &Session{opts: newOptions()}
+	s.opts.InitializeArgs.LinesStartAt1 = false
+	if got := displayLine(s, 41); got != 42 {
+		t.Errorf("displayLine(41) = %d, want 42", got)
+	}
+	if got := protocolLine(s, 42); got != 41 {
+		t.Errorf("protocolLine(42) = %d, want 41", got)
+	}
+}
+
+func TestExceptionBreakpointFilters(t *testing.T) {
+	s, adapter := newFakeSession(t)
+	go func() {
+		req, err := adapter.readRequest()
+		if err != nil {
+			return
+		}
+		adapter.write(map[string]interface{}{
+			"type":        "response",
+			"request_seq": req.Seq,
+			"command":     req.Command,
+			"success":     true,
+			"body": json.RawMessage(`{"exceptionBreakpointFilters": [
+				{"filter": "uncaught", "label": "Uncaught Exceptions", "default": true},
+				{"filter": "raised", "label": "Raised Exceptions", "description": "Every raise", "supportsCondition": true}
+			]}`),
+		})
+	}()
+	caps := initialize(s)
+
+	want := []ExceptionBreakpointsFilter{
+		{Filter: "uncaught", Label: "Uncaught Exceptions", Default: true},
+		{Filter: "raised", Label: "Raised Exceptions", Description: "Every raise", SupportsCondition: true},
+	}
+	if fmt.Sprint(caps.ExceptionBreakpointFilters) != fmt.Sprint(want) {
+		t.Errorf("got filters %+v, want %+v", caps.ExceptionBreakpointFilters, want)
+	}
+	// Only the default filter starts out enabled.
+	if got := s.getExceptionFilters(); fmt.Sprint(got) != "[uncaught]" {
+		t.Errorf("enabled filters %v, want [uncaught]", got)
+	}
+}
+
+// captureOutput collects the text printed for s.
+func captureOutput(s *Session) *bytes.Buffer {
+	var buf bytes.Buffer
+	s.opts.Out = &buf
+	return &buf
+}
+
+func TestExitedAndTerminated(t *testing.T) {
+	s := &Session{sessionState: newSessionState(), opts: newOptions()}
+	out := captureOutput(s)
+	s.setLaunched(LaunchRequestArgs{Program: "./prog"})
+	s.setStopped(1)
+
+	handleEvent(s, Event{Event: "exited", Body: json.RawMessage(`{"exitCode": 3}`)})
+	handleEvent(s, Event{Event: "terminated", Body: json.RawMessage(`{"restart": true}`)})
+	want := "program exited with code 3\n" +
+		"session terminated\n" +
+		"the adapter asked for a restart; run with --auto-restart to relaunch automatically\n"
+	if out.String() != want {
+		t.Errorf("printed %q, want %q", out.String(), want)
+	}
+	if mode := s.getMode(); mode != modeNone {
+		t.Errorf("mode %v after terminated, want none", mode)
+	}
+	if _, stopped := s.getCurrentThread(); stopped {
+		t.Error("thread still stopped after terminated")
+	}
+
+	// Stepping is refused without touching the adapter, which there isn't.
+	if err := nextCommand(s, nil); err == nil {
+		t.Error("next after terminated didn't fail")
+	}
+}
+
+func TestCapabilitiesEventMerges(t *testing.T) {
+	s := &Session{sessionState: newSessionState(), opts: newOptions()}
+	s.setCapabilities(Capabilities{SupportsConfigurationDoneRequest: true, SupportsStepBack: true})
+	handleEvent(s, Event{
+		Event: "capabilities",
+		Body:  json.RawMessage(`{"capabilities": {"supportsDisassembleRequest": true, "supportsStepBack": false}}`),
+	})
+	caps := s.getCapabilities()
+	if !caps.SupportsDisassembleRequest {
+		t.Error("new capability not added")
+	}
+	if caps.SupportsStepBack {
+		t.Error("withdrawn capability still set")
+	}
+	if !caps.SupportsConfigurationDoneRequest {
+		t.Error("capability missing from the update was lost")
+	}
+}
+
+func TestNoDebugLaunch(t *testing.T) {
+	s, adapter := newFakeSession(t)
+	s.opts.NoDebug = true
+	reqs := make(chan fakeRequest, 1)
+	go adapter.serve(func(req fakeRequest) interface{} {
+		reqs <- req
+		return nil
+	})
+	if err := launchSession(s, LaunchRequestArgs{Program: "./prog", Raw: map[string]interface{}{"stopOnEntry": true}}); err != nil {
+		t.Fatal(err)
+	}
+	var args map[string]interface{}
+	json.Unmarshal((<-reqs).Arguments, &args)
+	if args["noDebug"] != true || args["program"] != "./prog" || args["stopOnEntry"] != true {
+		t.Errorf("launched with %v, want noDebug alongside the other arguments", args)
+	}
+	if !isNoDebug(s) {
+		t.Error("session not running without debugging")
+	}
+}
+
+func TestNoDebugOmitted(t *testing.T) {
+	b, err := json.Marshal(LaunchRequestArgs{Program: "./prog"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `{"program":"./prog"}`; string(b) != want {
+		t.Errorf("got %s, want %s", b, want)
+	}
+}
+
+func TestRawCapabilities(t *testing.T) {
+	s := &Session{sessionState: newSessionState(), opts: newOptions()}
+	var caps Capabilities
+	if err := json.Unmarshal([]byte(`{"supportsStepBack": true, "supportTerminateDebuggee": true}`), &caps); err != nil {
+		t.Fatal(err)
+	}
+	s.setCapabilities(caps)
+	handleEvent(s, Event{
+		Event: "capabilities",
+		Body:  json.RawMessage(`{"capabilities": {"supportsStepBack": false, "supportsDisassembleRequest": true}}`),
+	})
+	b, _ := json.Marshal(s.getCapabilities().Raw)
+	want := `{"supportTerminateDebuggee":true,"supportsDisassembleRequest":true,"supportsStepBack":false}`
+	if string(b) != want {
+		t.Errorf("raw capabilities %s, want %s", b, want)
+	}
+	if string(caps.Raw["supportsStepBack"]) != "true" {
+		t.Error("capabilities event changed an earlier copy")
+	}
+}
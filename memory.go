@@ -0,0 +1,145 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+type ReadMemoryArgs struct {
+	MemoryReference string `json:"memoryReference"`
+	Offset          int    `json:"offset,omitempty"`
+	Count           int    `json:"count"`
+}
+
+type ReadMemoryResponseBody struct {
+	Address         string `json:"address"`
+	UnreadableBytes int    `json:"unreadableBytes,omitempty"`
+	// Data is base64 encoded.
+	Data string `json:"data,omitempty"`
+}
+
+func ReadMemoryRequest(args ReadMemoryArgs) Request {
+	return Request{
+		ProtocolMessage: NewRequest(),
+		Command:         "readMemory",
+		Arguments:       args,
+	}
+}
+
+type WriteMemoryArgs struct {
+	MemoryReference string `json:"memoryReference"`
+	Offset          int    `json:"offset,omitempty"`
+	AllowPartial    bool   `json:"allowPartial,omitempty"`
+	// Data is base64 encoded.
+	Data string `json:"data"`
+}
+
+type WriteMemoryResponseBody struct {
+	Offset       int `json:"offset,omitempty"`
+	BytesWritten int `json:"bytesWritten,omitempty"`
+}
+
+func WriteMemoryRequest(args WriteMemoryArgs) Request {
+	return Request{
+		ProtocolMessage: NewRequest(),
+		Command:         "writeMemory",
+		Arguments:       args,
+	}
+}
+
+// hexdump prints data 16 bytes to a line, each line starting with its
+// address.
+func hexdump(w io.Writer, address uint64, data []byte) {
+	for i := 0; i < len(data); i += 16 {
+		row := data[i:]
+		if len(row) > 16 {
+			row = row[:16]
+		}
+		var hexPart, text strings.Builder
+		for j := 0; j < 16; j++ {
+			if j == 8 {
+				hexPart.WriteByte(' ')
+			}
+			if j >= len(row) {
+				hexPart.WriteString("   ")
+				continue
+			}
+			fmt.Fprintf(&hexPart, "%02x ", row[j])
+			if row[j] >= 0x20 && row[j] < 0x7f {
+				text.WriteByte(row[j])
+			} else {
+				text.WriteByte('.')
+			}
+		}
+		fmt.Fprintf(w, "%#08x  %s |%s|\n", address+uint64(i), hexPart.String(), text.String())
+	}
+}
+
+func readMemoryCommand(s *Session, args []string) error {
+	if len(args) != 2 {
+		return errors.New("usage: x <memory reference> <count>")
+	}
+	count, err := strconv.Atoi(args[1])
+	if err != nil || count <= 0 {
+		return fmt.Errorf("bad byte count %q", args[1])
+	}
+	resp, err := sendAndWait(s, ReadMemoryRequest(ReadMemoryArgs{MemoryReference: args[0], Count: count}))
+	if err != nil {
+		return err
+	}
+	var body ReadMemoryResponseBody
+	if err := json.Unmarshal(resp.Body, &body); err != nil {
+		return fmt.Errorf("failed to read readMemory response: %s", err)
+	}
+	data, err := base64.StdEncoding.DecodeString(body.Data)
+	if err != nil {
+		return fmt.Errorf("bad memory data: %s", err)
+	}
+	// Addresses are usually hex, but the adapter may use anything, in
+	// which case offsets are shown instead.
+	address, err := strconv.ParseUint(body.Address, 0, 64)
+	if err != nil {
+		address = 0
+	}
+	hexdump(s.opts.Out, address, data)
+	if body.UnreadableBytes > 0 {
+		fmt.Fprintf(s.opts.Out, "%d bytes after %#x could not be read\n", body.UnreadableBytes, address+uint64(len(data)))
+	}
+	return nil
+}
+
+func writeMemoryCommand(s *Session, args []string) error {
+	if len(args) < 2 {
+		return errors.New("usage: wmem <memory reference> <hex bytes>")
+	}
+	data, err := hex.DecodeString(strings.Join(args[1:], ""))
+	if err != nil {
+		return fmt.Errorf("bad hex bytes: %s", err)
+	}
+	req := WriteMemoryRequest(WriteMemoryArgs{
+		MemoryReference: args[0],
+		Data:            base64.StdEncoding.EncodeToString(data),
+	})
+	resp, err := sendAndWait(s, req)
+	if err != nil {
+		return err
+	}
+	var body WriteMemoryResponseBody
+	if len(resp.Body) > 0 {
+		if err := json.Unmarshal(resp.Body, &body); err != nil {
+			return fmt.Errorf("failed to read writeMemory response: %s", err)
+		}
+	}
+	written := len(data)
+	if body.BytesWritten > 0 {
+		written = body.BytesWritten
+	}
+	fmt.Fprintf(s.opts.Out, "wrote %d bytes to %s\n", written, args[0])
+	return nil
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"text/tabwriter"
+)
+
+// ModuleID identifies a module. Adapters may send either a number or a
+// string, so it's kept in its JSON form.
+type ModuleID string
+
+func (id *ModuleID) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err == nil {
+		*id = ModuleID(s)
+		return nil
+	}
+	var n json.Number
+	if err := json.Unmarshal(b, &n); err != nil {
+		return fmt.Errorf("module id must be a number or string, got %s", b)
+	}
+	*id = ModuleID(n)
+	return nil
+}
+
+type Module struct {
+	ID          ModuleID `json:"id"`
+	Name        string   `json:"name"`
+	Path        string   `json:"path,omitempty"`
+	IsOptimized bool     `json:"isOptimized,omitempty"`
+	IsUserCode  bool     `json:"isUserCode,omitempty"`
+	Version     string   `json:"version,omitempty"`
+}
+
+type ModulesArgs struct {
+	StartModule int `json:"startModule,omitempty"`
+	ModuleCount int `json:"moduleCount,omitempty"`
+}
+
+type ModulesResponseBody struct {
+	Modules      []Module `json:"modules"`
+	TotalModules int      `json:"totalModules,omitempty"`
+}
+
+type ModuleEventBody struct {
+	Reason string `json:"reason"`
+	Module Module `json:"module"`
+}
+
+func ModulesRequest(args ModulesArgs) Request {
+	return Request{
+		ProtocolMessage: NewRequest(),
+		Command:         "modules",
+		Arguments:       args,
+	}
+}
+
+func handleModuleEvent(s *Session, event Event) {
+	var body ModuleEventBody
+	if err := json.Unmarshal(event.Body, &body); err != nil {
+		log.Printf("failed to read module event: %s", err)
+		return
+	}
+	s.updateModule(body.Reason, body.Module)
+}
+
+func modulesCommand(s *Session, args []string) error {
+	var modules []Module
+	if checkSupported(s, "modules") == nil {
+		resp, err := sendAndWait(s, ModulesRequest(ModulesArgs{}))
+		if err != nil {
+			return err
+		}
+		var body ModulesResponseBody
+		if err := json.Unmarshal(resp.Body, &body); err != nil {
+			return fmt.Errorf("failed to read modules: %s", err)
+		}
+		modules = body.Modules
+		s.setModules(modules)
+	} else {
+		// Fall back to what module events have told us.
+		modules = s.getModules()
+	}
+	if len(modules) == 0 {
+		fmt.Fprintln(s.opts.Out, "no modules")
+		return nil
+	}
+	w := tabwriter.NewWriter(s.opts.Out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tNAME\tVERSION\tFLAGS\tPATH")
+	for _, m := range modules {
+		var flags []string
+		if m.IsOptimized {
+			flags = append(flags, "optimized")
+		}
+		if m.IsUserCode {
+			flags = append(flags, "user")
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", m.ID, m.Name, m.Version, strings.Join(flags, ","), m.Path)
+	}
+	w.Flush()
+	return nil
+}
@@ -0,0 +1,21 @@
+package main
+
+// isNoDebug reports whether the debuggee is being run without debugging,
+// either because of --no-debug or because its launch arguments say so.
+func isNoDebug(s *Session) bool {
+	if s.opts.NoDebug {
+		return true
+	}
+	mode, launchArgs, _ := s.getStartArgs()
+	return mode == modeLaunch && launchArgs.NoDebug
+}
+
+// noDebugEvents are the events still handled when running without
+// debugging. The rest would only be noise around the program's output.
+var noDebugEvents = map[string]bool{
+	"initialized":  true,
+	"capabilities": true,
+	"output":       true,
+	"exited":       true,
+	"terminated":   true,
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// Options holds what the command line and the config file set up. Each
+// session is given the options it runs with, and the child sessions it
+// starts share them.
+type Options struct {
+	// InitializeArgs are what the client sends with the initialize request.
+	// Lines and columns are 1-based and paths are native file paths, which
+	// is what users expect to see and type.
+	InitializeArgs InitializeRequestArgs
+	// AdapterID is set by --adapter-id, or by the adapter id in the
+	// --config-name configuration, and tells the adapter and the client
+	// which adapter it is.
+	AdapterID string
+	// Timeout is set by --timeout, and given to each session's client as
+	// how long to wait for a response.
+	Timeout time.Duration
+	// ConnectRetries is how many more times to try connecting to the
+	// adapter if the first attempt fails, waiting ConnectInterval between
+	// attempts. They're set by --connect-retries and --connect-interval.
+	ConnectRetries  int
+	ConnectInterval time.Duration
+
+	// JSON is set by --output=json. Commands that support it then print a
+	// single CommandResult instead of text, and each event is printed as
+	// an EventResult. Everything else goes to stderr, so stdout is one JSON
+	// object per line.
+	JSON bool
+	// Out is where text for the user goes: what commands print, what
+	// event handlers report, and the debuggee's output. Results is where
+	// printJSON writes.
+	Out     io.Writer
+	Results io.Writer
+
+	// ConfigPath is where the config file is read from, and ConfigName is
+	// the configuration given by --config-name, which is launched or
+	// attached as soon as the session starts.
+	ConfigPath string
+	ConfigName string
+	// Config is the loaded config file, if there is one.
+	Config ConfigFile
+	// StepIntoFilter holds the globs of source paths that step skips over.
+	// It starts out as the config file's stepIntoFilter, and skip add adds
+	// to it.
+	StepIntoFilter []string
+
+	// ScriptPath is set by --script to a file of commands to run instead
+	// of reading them interactively.
+	ScriptPath string
+	// HistoryPath is where command history is persisted between sessions.
+	// An empty path disables persistence.
+	HistoryPath string
+	// RepeatLast is whether an empty line repeats the last command, if
+	// it's repeatable. It is toggled by set repeat.
+	RepeatLast bool
+
+	// AutoRestart is set by --auto-restart, and relaunches the debuggee
+	// when the adapter asks for a restart.
+	AutoRestart bool
+	// NoDebug is set by --no-debug, in which case programs are launched
+	// without debugging: the adapter just runs them, and only their output
+	// is shown.
+	NoDebug bool
+	// StopOnError is set by --stop-on-error, and stops a script at the
+	// first command that fails.
+	StopOnError bool
+	// NoAutoStack is set by --no-auto-stack, and stops the stack trace
+	// from being fetched and cached each time a thread stops.
+	NoAutoStack bool
+	// DryRun is set by --dry-run, in which case no adapter is connected
+	// to, and the session's client prints requests instead of sending
+	// them.
+	DryRun bool
+	// ShowVersion is set by --version.
+	ShowVersion bool
+
+	// interrupts is closed, and replaced, each time Ctrl-C is pressed while
+	// no request is waiting for a response, so that commands waiting on
+	// the debuggee can stop waiting.
+	interruptMu sync.Mutex
+	interrupts  chan struct{}
+}
+
+// newOptions returns the options used unless the command line says
+// otherwise.
+func newOptions() *Options {
+	return &Options{
+		InitializeArgs: InitializeRequestArgs{
+			AdapterID:       "dap-cli",
+			LinesStartAt1:   true,
+			ColumnsStartAt1: true,
+			PathFormat:      "path",
+			// Progress events are shown on stderr.
+			SupportsProgressReporting: true,
+			// Programs are run in the CLI's own terminal.
+			SupportsRunInTerminal: true,
+		},
+		Timeout:         defaultRequestTimeout,
+		ConnectInterval: 500 * time.Millisecond,
+		Out:             os.Stdout,
+		Results:         os.Stdout,
+		ConfigPath:      defaultConfigPath,
+		HistoryPath:     defaultHistoryPath(),
+		RepeatLast:      true,
+		interrupts:      make(chan struct{}),
+	}
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+)
+
+// CommandResult is printed for each command in JSON mode. Command is empty
+// for errors that didn't come from a command. Body depends on the command:
+//
+//	bt       the stack frames, as in the stackTrace response
+//	vars     an array of {"scope", "variables"} objects
+//	eval     the evaluate response body
+//	threads  the threads, as in the threads response
+type CommandResult struct {
+	Command string      `json:"command,omitempty"`
+	Success bool        `json:"success"`
+	Error   string      `json:"error,omitempty"`
+	Body    interface{} `json:"body,omitempty"`
+}
+
+// EventResult is printed for each event in JSON mode, with the event's body
+// as sent by the adapter.
+type EventResult struct {
+	Event string          `json:"event"`
+	Body  json.RawMessage `json:"body,omitempty"`
+}
+
+// setOutputMode applies the value of the --output option, which is either
+// "text" or "json".
+func setOutputMode(o *Options, mode string) error {
+	switch mode {
+	case "text":
+		o.JSON = false
+		o.Out = o.Results
+	case "json":
+		o.JSON = true
+		// Text printed by commands that don't support JSON would otherwise
+		// end up mixed in with the JSON.
+		o.Out = os.Stderr
+	default:
+		return fmt.Errorf("unknown output mode %q: expected text or json", mode)
+	}
+	return nil
+}
+
+func printJSON(s *Session, v interface{}) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		log.Printf("failed to encode output: %s", err)
+		return
+	}
+	fmt.Fprintln(s.opts.Results, string(b))
+}
+
+// commandError reports that command failed, as a CommandResult in JSON
+// mode.
+func commandError(s *Session, command string, err error) {
+	if s.opts.JSON {
+		printResult(s, command, nil, err)
+		return
+	}
+	printError(s, "%s", err)
+}
+
+// printResult prints the outcome of a command in JSON mode.
+func printResult(s *Session, command string, body interface{}, err error) {
+	result := CommandResult{Command: command, Success: err == nil, Body: body}
+	if err != nil {
+		result.Error = err.Error()
+	}
+	printJSON(s, result)
+}
@@ -0,0 +1,13 @@
+//go:build !windows
+
+package main
+
+import (
+	"errors"
+	"io"
+)
+
+// openPipe fails right away, since there's no point retrying.
+func openPipe(opts *Options, name string) (io.ReadWriteCloser, error) {
+	return nil, errors.New("named pipes are only supported on Windows")
+}
@@ -0,0 +1,25 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/Microsoft/go-winio"
+)
+
+// openPipe connects to an adapter listening on the named pipe, e.g.
+// \\.\pipe\adapter, retrying as --connect-retries says.
+func openPipe(opts *Options, name string) (io.ReadWriteCloser, error) {
+	return withRetries(opts, name, func(name string) (io.ReadWriteCloser, error) {
+		return dialPipe(name, opts.Timeout)
+	})
+}
+
+func dialPipe(name string, timeout time.Duration) (io.ReadWriteCloser, error) {
+	conn, err := winio.DialPipe(name, &timeout)
+	if err != nil {
+		return nil, fmt.Errorf("failed to dial %s: %s", name, err)
+	}
+	return conn, nil
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+)
+
+type ProgressStartEventBody struct {
+	ProgressID  string   `json:"progressId"`
+	Title       string   `json:"title"`
+	RequestID   int64    `json:"requestId,omitempty"`
+	Cancellable bool     `json:"cancellable,omitempty"`
+	Message     string   `json:"message,omitempty"`
+	Percentage  *float64 `json:"percentage,omitempty"`
+}
+
+type ProgressUpdateEventBody struct {
+	ProgressID string   `json:"progressId"`
+	Message    string   `json:"message,omitempty"`
+	Percentage *float64 `json:"percentage,omitempty"`
+}
+
+type ProgressEndEventBody struct {
+	ProgressID string `json:"progressId"`
+	Message    string `json:"message,omitempty"`
+}
+
+// progressReports are the adapter's progress reports that haven't ended yet,
+// keyed by progress ID.
+var progressReports = struct {
+	sync.Mutex
+	active map[string]*ProgressStartEventBody
+}{active: make(map[string]*ProgressStartEventBody)}
+
+// progressInPlace is set if progress can be redrawn in place on stderr.
+var progressInPlace = isTerminal(os.Stderr)
+
+func handleProgressEvent(s *Session, event Event) {
+	progressReports.Lock()
+	defer progressReports.Unlock()
+	switch event.Event {
+	case "progressStart":
+		var body ProgressStartEventBody
+		if err := json.Unmarshal(event.Body, &body); err != nil {
+			log.Printf("failed to read progressStart event: %s", err)
+			return
+		}
+		progressReports.active[body.ProgressID] = &body
+		if !progressInPlace {
+			fmt.Fprintln(os.Stderr, body.Title)
+		}
+		if body.Cancellable && checkSupported(s, "cancel") == nil {
+			clearProgress()
+			fmt.Fprintf(os.Stderr, "%s can be cancelled with: cancel %s\n", body.Title, body.ProgressID)
+		}
+	case "progressUpdate":
+		var body ProgressUpdateEventBody
+		if err := json.Unmarshal(event.Body, &body); err != nil {
+			log.Printf("failed to read progressUpdate event: %s", err)
+			return
+		}
+		report, ok := progressReports.active[body.ProgressID]
+		if !ok {
+			return
+		}
+		if body.Message != "" {
+			report.Message = body.Message
+		}
+		if body.Percentage != nil {
+			report.Percentage = body.Percentage
+		}
+	case "progressEnd":
+		var body ProgressEndEventBody
+		if err := json.Unmarshal(event.Body, &body); err != nil {
+			log.Printf("failed to read progressEnd event: %s", err)
+			return
+		}
+		report, ok := progressReports.active[body.ProgressID]
+		if !ok {
+			return
+		}
+		delete(progressReports.active, body.ProgressID)
+		if !progressInPlace {
+			done := report.Title + ": done"
+			if body.Message != "" {
+				done += ": " + body.Message
+			}
+			fmt.Fprintln(os.Stderr, done)
+		}
+	}
+	drawProgress()
+}
+
+// drawProgress redraws every active progress report on a single line of
+// stderr, or clears it if none are left. The caller must hold
+// progressReports.
+func drawProgress() {
+	if !progressInPlace {
+		return
+	}
+	ids := make([]string, 0, len(progressReports.active))
+	for id := range progressReports.active {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	parts := make([]string, len(ids))
+	for i, id := range ids {
+		parts[i] = formatProgress(progressReports.active[id])
+	}
+	clearProgress()
+	if len(parts) > 0 {
+		fmt.Fprint(os.Stderr, colorize(colorCyan, strings.Join(parts, " | ")))
+	}
+}
+
+// clearProgress clears the line that progress is drawn on.
+func clearProgress() {
+	if progressInPlace {
+		fmt.Fprint(os.Stderr, "\r\x1b[K")
+	}
+}
+
+// formatProgress renders a progress report as a title, a bar if the
+// percentage is known, and the latest message.
+func formatProgress(report *ProgressStartEventBody) string {
+	const width = 20
+	s := report.Title
+	if report.Percentage != nil {
+		p := *report.Percentage
+		if p < 0 {
+			p = 0
+		} else if p > 100 {
+			p = 100
+		}
+		filled := int(p / 100 * width)
+		s += fmt.Sprintf(" [%s%s] %3.0f%%", strings.Repeat("#", filled), strings.Repeat(" ", width-filled), p)
+	}
+	if report.Message != "" {
+		s += " " + report.Message
+	}
+	return s
+}
+
+func cancelCommand(s *Session, args []string) error {
+	if len(args) != 1 {
+		return errors.New("usage: cancel <progress id>")
+	}
+	progressReports.Lock()
+	report, ok := progressReports.active[args[0]]
+	progressReports.Unlock()
+	if !ok {
+		return fmt.Errorf("no progress %s", args[0])
+	}
+	if !report.Cancellable {
+		return fmt.Errorf("%s can't be cancelled", report.Title)
+	}
+	_, err := sendAndWait(s, CancelRequest(CancelArgs{ProgressID: args[0]}))
+	return err
+}
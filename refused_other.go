@@ -0,0 +1,14 @@
+//go:build !plan9
+
+package main
+
+import (
+	"errors"
+	"syscall"
+)
+
+// isConnRefused reports whether err is from connecting to a socket nothing
+// is listening on.
+func isConnRefused(err error) bool {
+	return errors.Is(err, syscall.ECONNREFUSED)
+}
@@ -0,0 +1,7 @@
+package main
+
+// isConnRefused always reports false, since Plan 9 has no errno to tell a
+// refused connection by.
+func isConnRefused(err error) bool {
+	return false
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// RestartArgs holds the latest launch or attach arguments, which the
+// adapter restarts the session with.
+type RestartArgs struct {
+	Arguments interface{} `json:"arguments,omitempty"`
+}
+
+func RestartRequest(args RestartArgs) Request {
+	return Request{
+		ProtocolMessage: NewRequest(),
+		Command:         "restart",
+		Arguments:       args,
+	}
+}
+
+// restartCommand restarts the session with the arguments it was started
+// with. Adapters that can't restart have the debuggee terminated and
+// launched again instead.
+func restartCommand(s *Session, args []string) error {
+	mode, launchArgs, attachArgs := s.getStartArgs()
+	if mode == modeNone {
+		return errors.New("no active session; use launch or attach first")
+	}
+	if checkSupported(s, "restart") == nil {
+		restartArgs := RestartArgs{Arguments: launchArgs}
+		if mode == modeAttach {
+			restartArgs.Arguments = attachArgs
+		}
+		s.setRestarting()
+		initialized := s.waitForEvent("initialized")
+		if _, err := sendAndWait(s, RestartRequest(restartArgs)); err != nil {
+			return err
+		}
+		waitForRestart(s, initialized)
+		return nil
+	}
+	if mode == modeAttach {
+		return errors.New("adapter does not support restarting an attached session")
+	}
+	if err := checkSupported(s, "terminate"); err != nil {
+		// Disconnecting would close the connection, so there would be
+		// nothing to launch the debuggee again with.
+		return errors.New("adapter does not support restart or terminate")
+	}
+	terminated := s.waitForEvent("terminated")
+	if _, err := sendAndWait(s, TerminateRequest(TerminateArgs{})); err != nil {
+		return err
+	}
+	select {
+	case <-terminated:
+	case <-time.After(s.Timeout):
+		return fmt.Errorf("debuggee did not terminate after %s", s.Timeout)
+	}
+	initialized := s.waitForEvent("initialized")
+	if _, err := sendInitialize(s); err != nil {
+		return fmt.Errorf("restart failed: %s", err)
+	}
+	if err := launchSession(s, launchArgs); err != nil {
+		return fmt.Errorf("restart failed: %s", err)
+	}
+	waitForRestart(s, initialized)
+	return nil
+}
+
+// waitForRestart waits for the restarted session to be initialized, at which
+// point the configuration sequence sends the breakpoints again.
+func waitForRestart(s *Session, initialized <-chan struct{}) {
+	select {
+	case <-initialized:
+		fmt.Fprintln(s.opts.Out, "restarted")
+	case <-time.After(s.Timeout):
+		// Not every adapter initializes again after restarting in place,
+		// in which case it has kept the configuration it had.
+		s.setConfigured()
+		fmt.Fprintln(s.opts.Out, "restarted, but the adapter did not initialize again")
+	}
+}
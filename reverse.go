@@ -0,0 +1,156 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// ReverseRequest is a request sent by the adapter to the client.
+type ReverseRequest struct {
+	ProtocolMessage
+	Command   string          `json:"command"`
+	Arguments json.RawMessage `json:"arguments,omitempty"`
+}
+
+// StartDebuggingArgs asks the client to start a child session, configured
+// as if by a launch or attach request with the given arguments.
+type StartDebuggingArgs struct {
+	Configuration map[string]interface{} `json:"configuration"`
+	// Request is either launch or attach.
+	Request string `json:"request"`
+}
+
+// reverseRequestHandlers answer the requests an adapter can send the client.
+// Each returns the body of a successful response, or an error.
+var reverseRequestHandlers = map[string]func(s *Session, args json.RawMessage) (interface{}, error){
+	"startDebugging": handleStartDebugging,
+	"runInTerminal":  handleRunInTerminal,
+}
+
+// handleReverseRequest answers a request from the adapter. Requests the
+// client doesn't know get an unsuccessful response, so that the adapter
+// isn't left waiting.
+func handleReverseRequest(s *Session, req ReverseRequest) {
+	handler, ok := reverseRequestHandlers[req.Command]
+	if !ok {
+		sendResponse(s, req, nil, fmt.Errorf("unsupported request %q", req.Command))
+		return
+	}
+	body, err := handler(s, req.Arguments)
+	sendResponse(s, req, body, err)
+}
+
+// sendResponse answers req with body, or with err if it isn't nil.
+func sendResponse(s *Session, req ReverseRequest, body interface{}, err error) {
+	resp := Response{
+		ProtocolMessage: ProtocolMessage{Type: "response"},
+		RequestSeq:      req.Seq,
+		Success:         err == nil,
+		Command:         req.Command,
+	}
+	if err != nil {
+		resp.Message = err.Error()
+	} else if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			log.Printf("failed to send %s response: %s", req.Command, err)
+			return
+		}
+		resp.Body = b
+	}
+	s.sendResponse(resp)
+}
+
+// handleStartDebugging starts the child session the adapter asks for. The
+// adapter is answered straight away, since the child can't be started
+// while the parent's messages wait to be read.
+func handleStartDebugging(s *Session, args json.RawMessage) (interface{}, error) {
+	var body StartDebuggingArgs
+	if err := json.Unmarshal(args, &body); err != nil {
+		return nil, fmt.Errorf("bad arguments: %s", err)
+	}
+	if body.Request != "launch" && body.Request != "attach" {
+		return nil, fmt.Errorf("unknown request %q: expected launch or attach", body.Request)
+	}
+	if s.reconnect == nil {
+		return nil, fmt.Errorf("child sessions can't be started over this connection")
+	}
+	go func() {
+		if err := startChildSession(s, body); err != nil {
+			printError(s, "failed to start child session: %s", err)
+		}
+	}()
+	return nil, nil
+}
+
+// RunInTerminalArgs asks the client to run the debuggee for the adapter.
+type RunInTerminalArgs struct {
+	// Kind is integrated or external.
+	Kind  string   `json:"kind,omitempty"`
+	Title string   `json:"title,omitempty"`
+	Cwd   string   `json:"cwd"`
+	Args  []string `json:"args"`
+	// Env holds variables to add to the environment, or to remove from it
+	// if their value is null.
+	Env map[string]*string `json:"env,omitempty"`
+}
+
+type RunInTerminalResponseBody struct {
+	ProcessID int `json:"processId,omitempty"`
+}
+
+// handleRunInTerminal starts the program the adapter asks for. There's no
+// terminal to run it in other than this one, so both kinds of request are
+// handled the same way, with the program's output going to ours.
+func handleRunInTerminal(s *Session, args json.RawMessage) (interface{}, error) {
+	var body RunInTerminalArgs
+	if err := json.Unmarshal(args, &body); err != nil {
+		return nil, fmt.Errorf("bad arguments: %s", err)
+	}
+	if len(body.Args) == 0 {
+		return nil, fmt.Errorf("no program to run")
+	}
+	cmd := exec.Command(body.Args[0], body.Args[1:]...)
+	cmd.Dir = body.Cwd
+	cmd.Stdout = os.Stdout
+	if s.opts.JSON {
+		// Stdout is kept for the JSON.
+		cmd.Stdout = os.Stderr
+	}
+	cmd.Stderr = os.Stderr
+	if len(body.Env) > 0 {
+		cmd.Env = mergeEnv(os.Environ(), body.Env)
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("failed to start %s: %s", body.Args[0], err)
+	}
+	fmt.Fprintf(s.opts.Out, "started %s (pid %d)\n", body.Args[0], cmd.Process.Pid)
+	go func() {
+		if err := cmd.Wait(); err != nil {
+			log.Printf("%s: %s", body.Args[0], err)
+		}
+	}()
+	return RunInTerminalResponseBody{ProcessID: cmd.Process.Pid}, nil
+}
+
+// mergeEnv applies changes to environ, a list of key=value pairs, removing
+// the variables whose value is nil.
+func mergeEnv(environ []string, changes map[string]*string) []string {
+	var env []string
+	for _, kv := range environ {
+		key, _, _ := strings.Cut(kv, "=")
+		if _, ok := changes[key]; !ok {
+			env = append(env, kv)
+		}
+	}
+	for key, value := range changes {
+		if value != nil {
+			env = append(env, key+"="+*value)
+		}
+	}
+	return env
+}
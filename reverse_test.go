@@ -0,0 +1,118 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+// reverseRequest sends the client a request from the adapter and returns the
+// client's response.
+func (a *fakeAdapter) reverseRequest(t *testing.T, command string, args interface{}) Response {
+	t.Helper()
+	err := a.write(map[string]interface{}{"type": "request", "command": command, "arguments": args})
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := a.readMessage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var resp Response
+	if err := json.Unmarshal(body, &resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Type != "response" || resp.Command != command || resp.RequestSeq != a.seq {
+		t.Fatalf("got %s, want the response to %s request %d", body, command, a.seq)
+	}
+	return resp
+}
+
+func TestStartDebuggingStartsChild(t *testing.T) {
+	s, adapter := newFakeSession(t)
+	out := captureOutput(s)
+	useSession(t, s)
+	sessions.mu.Lock()
+	list := sessions.list
+	sessions.mu.Unlock()
+	t.Cleanup(func() {
+		sessions.mu.Lock()
+		sessions.list = list
+		sessions.mu.Unlock()
+	})
+	s.addBreakpoint("/src/a.go", SourceBreakpoint{Line: 3})
+	childClient, childAdapter := newFakeAdapter(t)
+	s.reconnect = func() (io.ReadWriteCloser, error) { return childClient.ReadWriteCloser, nil }
+	reqs := make(chan fakeRequest, 2)
+	go childAdapter.serve(func(req fakeRequest) interface{} {
+		reqs <- req
+		if req.Command == "initialize" {
+			return Capabilities{}
+		}
+		return nil
+	})
+
+	resp := adapter.reverseRequest(t, "startDebugging", map[string]interface{}{
+		"request":       "launch",
+		"configuration": map[string]interface{}{"name": "child", "program": "./child"},
+	})
+	if !resp.Success {
+		t.Fatalf("startDebugging failed: %s", resp.Message)
+	}
+	if req := <-reqs; req.Command != "initialize" {
+		t.Fatalf("child sent %s first, want initialize", req.Command)
+	}
+	req := <-reqs
+	var args map[string]interface{}
+	json.Unmarshal(req.Arguments, &args)
+	if req.Command != "launch" || args["program"] != "./child" || args["name"] != "child" {
+		t.Fatalf("child sent %s %v, want launch with the configuration", req.Command, args)
+	}
+	var child *Session
+	for deadline := time.Now().Add(time.Second); child == nil || child == s; time.Sleep(10 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("child session never became current")
+		}
+		child = currentSession()
+	}
+	if bps := child.getBreakpoints()["/src/a.go"]; len(bps) != 1 || bps[0].Line != 3 {
+		t.Errorf("child has breakpoints %v, want the parent's", bps)
+	}
+
+	// Once the child's connection closes, the parent is current again.
+	childAdapter.conn.Close()
+	for deadline := time.Now().Add(time.Second); currentSession() != s; time.Sleep(10 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("parent session not current after the child ended")
+		}
+	}
+	if want := fmt.Sprintf("session %d ended", child.ID); !strings.Contains(out.String(), want) {
+		t.Errorf("printed %q, want it to say %s", out.String(), want)
+	}
+}
+
+func TestRunInTerminal(t *testing.T) {
+	s, adapter := newFakeSession(t)
+	captureOutput(s)
+	resp := adapter.reverseRequest(t, "runInTerminal", RunInTerminalArgs{Kind: "integrated", Args: []string{"echo", "hello"}})
+	if !resp.Success {
+		t.Fatalf("runInTerminal failed: %s", resp.Message)
+	}
+	var body RunInTerminalResponseBody
+	if err := json.Unmarshal(resp.Body, &body); err != nil {
+		t.Fatal(err)
+	}
+	if body.ProcessID <= 0 {
+		t.Errorf("got process ID %d", body.ProcessID)
+	}
+}
+
+func TestUnknownReverseRequestRefused(t *testing.T) {
+	_, adapter := newFakeSession(t)
+	if resp := adapter.reverseRequest(t, "frobnicate", nil); resp.Success {
+		t.Error("unknown request answered successfully")
+	}
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// launchSchema describes the launch arguments an adapter accepts, in just
+// enough detail to catch common mistakes before the adapter reports them
+// less clearly. Arguments it doesn't list aren't checked.
+type launchSchema struct {
+	// oneOf lists arguments of which at least one must be given.
+	oneOf  []string
+	fields map[string]schemaField
+}
+
+type schemaField struct {
+	// types are the JSON types the argument may have, separated by |.
+	types string
+	// values, if set, are the only values a string argument may have.
+	values []string
+}
+
+// launchSchemas are the built-in schemas, keyed by adapter. To check another
+// adapter's arguments, add an entry here, and to launchSchemaAliases if it
+// goes by other adapter IDs.
+var launchSchemas = map[string]launchSchema{
+	"delve": {
+		oneOf: []string{"program"},
+		fields: map[string]schemaField{
+			"mode":                {types: "string", values: []string{"debug", "test", "exec", "replay", "core"}},
+			"program":             {types: "string"},
+			"args":                {types: "array"},
+			"cwd":                 {types: "string"},
+			"env":                 {types: "object"},
+			"buildFlags":          {types: "string|array"},
+			"output":              {types: "string"},
+			"stopOnEntry":         {types: "boolean"},
+			"backend":             {types: "string", values: []string{"default", "native", "lldb", "rr"}},
+			"substitutePath":      {types: "array"},
+			"showGlobalVariables": {types: "boolean"},
+			"traceDirPath":        {types: "string"},
+			"coreFilePath":        {types: "string"},
+		},
+	},
+	"debugpy": {
+		oneOf: []string{"program", "module", "code"},
+		fields: map[string]schemaField{
+			"program":        {types: "string"},
+			"module":         {types: "string"},
+			"code":           {types: "string"},
+			"args":           {types: "array|string"},
+			"cwd":            {types: "string"},
+			"env":            {types: "object"},
+			"python":         {types: "string|array"},
+			"console":        {types: "string", values: []string{"internalConsole", "integratedTerminal", "externalTerminal"}},
+			"justMyCode":     {types: "boolean"},
+			"stopOnEntry":    {types: "boolean"},
+			"redirectOutput": {types: "boolean"},
+			"subProcess":     {types: "boolean"},
+			"django":         {types: "boolean"},
+			"sudo":           {types: "boolean"},
+		},
+	},
+	"node": {
+		oneOf: []string{"program", "runtimeExecutable"},
+		fields: map[string]schemaField{
+			"program":           {types: "string"},
+			"args":              {types: "array"},
+			"cwd":               {types: "string"},
+			"env":               {types: "object"},
+			"runtimeExecutable": {types: "string"},
+			"runtimeArgs":       {types: "array"},
+			"console":           {types: "string", values: []string{"internalConsole", "integratedTerminal", "externalTerminal"}},
+			"stopOnEntry":       {types: "boolean"},
+			"sourceMaps":        {types: "boolean"},
+			"outFiles":          {types: "array"},
+			"skipFiles":         {types: "array"},
+		},
+	},
+}
+
+// launchSchemaAliases map other adapter IDs to the schema that applies to
+// them.
+var launchSchemaAliases = map[string]string{
+	"go":       "delve",
+	"dlv":      "delve",
+	"python":   "debugpy",
+	"pwa-node": "node",
+}
+
+// checkLaunchArgs returns warnings about launch arguments that the schema
+// for adapterID says are wrong. There are none for adapters without a
+// schema.
+func checkLaunchArgs(adapterID string, args LaunchRequestArgs) []string {
+	name := strings.ToLower(adapterID)
+	if alias, ok := launchSchemaAliases[name]; ok {
+		name = alias
+	}
+	schema, ok := launchSchemas[name]
+	if !ok {
+		return nil
+	}
+	// Checking the arguments as they'll be sent covers the common fields
+	// and the adapter-specific ones alike.
+	b, err := json.Marshal(args)
+	if err != nil {
+		return nil
+	}
+	var fields map[string]interface{}
+	if err := json.Unmarshal(b, &fields); err != nil {
+		return nil
+	}
+
+	var warnings []string
+	if len(schema.oneOf) > 0 && !hasAnyKey(fields, schema.oneOf) {
+		warnings = append(warnings, fmt.Sprintf("%s needs %s", name, strings.Join(schema.oneOf, " or ")))
+	}
+	keys := make([]string, 0, len(fields))
+	for key := range fields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		field, ok := schema.fields[key]
+		if !ok {
+			continue
+		}
+		typ := jsonType(fields[key])
+		if !strings.Contains("|"+field.types+"|", "|"+typ+"|") {
+			warnings = append(warnings, fmt.Sprintf("%s should be %s, not %s", key, strings.Replace(field.types, "|", " or ", -1), typ))
+			continue
+		}
+		if s, ok := fields[key].(string); ok && len(field.values) > 0 && !containsString(field.values, s) {
+			warnings = append(warnings, fmt.Sprintf("%s should be one of %s, not %q", key, strings.Join(field.values, ", "), s))
+		}
+	}
+	return warnings
+}
+
+func hasAnyKey(m map[string]interface{}, keys []string) bool {
+	for _, key := range keys {
+		if _, ok := m[key]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// jsonType returns the JSON type name of a value decoded into an
+// interface{}.
+func jsonType(v interface{}) string {
+	switch v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case float64:
+		return "number"
+	case string:
+		return "string"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	}
+	return fmt.Sprintf("%T", v)
+}
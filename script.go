@@ -0,0 +1,85 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+// runScript runs the commands read from r, one per line, and reports whether
+// they all succeeded. Each command goes to the current session. Blank lines
+// and lines starting with # are skipped. Unless the script disconnects
+// itself, the session is ended with quit once the script is done.
+func runScript(opts *Options, r io.Reader) bool {
+	ok := true
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if !opts.JSON {
+			fmt.Fprintln(opts.Out, colorize(colorGreen, "> ")+line)
+		}
+		s := currentSession()
+		if err := handleCommand(s, line); err != nil {
+			ok = false
+			if opts.StopOnError {
+				break
+			}
+		}
+		if s.isDisconnected() {
+			return ok
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		printError(currentSession(), "failed to read script: %s", err)
+		ok = false
+	}
+	handleCommand(currentSession(), "quit")
+	return ok
+}
+
+// openScript returns the commands to run non-interactively, if there are
+// any: the --script file, or stdin if it isn't a terminal.
+func openScript(opts *Options) (io.ReadCloser, error) {
+	if opts.ScriptPath != "" {
+		return os.Open(opts.ScriptPath)
+	}
+	if !isTerminal(os.Stdin) {
+		return io.NopCloser(os.Stdin), nil
+	}
+	return nil, nil
+}
+
+// defaultWaitTimeout is how long wait waits unless told otherwise.
+const defaultWaitTimeout = 30 * time.Second
+
+// waitCommand blocks until the debuggee stops or terminates, so that a
+// script can act on where it stopped. It returns right away if that has
+// already happened since the debuggee last ran.
+func waitCommand(s *Session, args []string) error {
+	if len(args) == 0 || len(args) > 2 || (args[0] != "stopped" && args[0] != "terminated") {
+		return errors.New("usage: wait stopped|terminated [timeout]")
+	}
+	timeout := defaultWaitTimeout
+	if len(args) == 2 {
+		d, err := time.ParseDuration(args[1])
+		if err != nil || d <= 0 {
+			return fmt.Errorf("bad timeout %q", args[1])
+		}
+		timeout = d
+	}
+	select {
+	case <-s.waitUntil(args[0]):
+	case <-time.After(timeout):
+		return fmt.Errorf("no %s event after %s", args[0], timeout)
+	case <-s.opts.interrupted():
+		return fmt.Errorf("interrupted waiting for %s", args[0])
+	}
+	return nil
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// useSession makes s the current session until the test ends.
+func useSession(t *testing.T, s *Session) {
+	sessions.mu.Lock()
+	old := sessions.current
+	sessions.current = s
+	sessions.mu.Unlock()
+	t.Cleanup(func() {
+		sessions.mu.Lock()
+		sessions.current = old
+		sessions.mu.Unlock()
+	})
+}
+
+func TestScriptContinueAndWait(t *testing.T) {
+	s, adapter := newFakeSession(t)
+	captureOutput(s)
+	useSession(t, s)
+	s.setLaunched(LaunchRequestArgs{Program: "./prog"})
+	s.setStopped(1)
+	commands := adapter.serveStepping("continue")
+
+	if !runScript(s.opts, strings.NewReader("continue\nwait stopped 1s\n")) {
+		t.Error("script failed")
+	}
+	var sent []string
+	for len(commands) > 0 {
+		sent = append(sent, <-commands)
+	}
+	// The stack trace is only asked for once the thread has stopped, so
+	// wait can't have returned before then.
+	if want := "[continue stackTrace disconnect]"; fmt.Sprint(sent) != want {
+		t.Errorf("sent %v, want %s", sent, want)
+	}
+}
+
+func TestScriptWaitTimesOut(t *testing.T) {
+	s, adapter := newFakeSession(t)
+	captureOutput(s)
+	s.opts.StopOnError = true
+	useSession(t, s)
+	s.setLaunched(LaunchRequestArgs{Program: "./prog"})
+	commands := adapter.serveStepping()
+
+	if runScript(s.opts, strings.NewReader("wait stopped 50ms\nthreads\n")) {
+		t.Error("script succeeded though nothing stopped")
+	}
+	for len(commands) > 0 {
+		if command := <-commands; command == "threads" {
+			t.Error("script carried on after wait timed out")
+		}
+	}
+}
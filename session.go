@@ -0,0 +1,901 @@
+package main
+
+import (
+	"encoding/json"
+	"sort"
+	"sync"
+)
+
+// sessionMode records how the debuggee was started.
+type sessionMode int
+
+const (
+	modeNone sessionMode = iota
+	modeLaunch
+	modeAttach
+)
+
+// sessionState holds what the client knows about a debug session.
+// It is shared between the REPL and the listen goroutine, so all access must
+// hold mu.
+type sessionState struct {
+	mu           sync.Mutex
+	capabilities Capabilities
+	// capabilitiesSet is closed once the capabilities from the latest
+	// initialize response have been stored.
+	capabilitiesSet chan struct{}
+	mode            sessionMode
+	// launchArgs are the arguments the debuggee was last launched with,
+	// and attachArgs those it was last attached with.
+	launchArgs LaunchRequestArgs
+	attachArgs AttachRequestArgs
+	// disconnected is set once the client has asked to disconnect, after
+	// which read errors on the connection are expected.
+	disconnected bool
+	// breakpoints holds the source breakpoints for each file, keyed by
+	// absolute path.
+	breakpoints         map[string][]SourceBreakpoint
+	functionBreakpoints []FunctionBreakpoint
+	// dataBreakpoints only last as long as the debuggee, since their data
+	// IDs generally can't be reused.
+	dataBreakpoints []DataBreakpoint
+	// instructionBreakpoints likewise refer to addresses in the running
+	// debuggee.
+	instructionBreakpoints []InstructionBreakpoint
+	// breakpointStatus is what the adapter last said about each breakpoint,
+	// keyed by its ID, along with where the breakpoint was set.
+	breakpointStatus map[int]reportedBreakpoint
+	// breakpointResults holds the adapter's response for each breakpoint,
+	// in the order they were last sent and kept up to date by breakpoint
+	// events. It is keyed by path for source breakpoints and by kind, as in
+	// functionBreakpoints, for the rest.
+	breakpointResults map[string][]Breakpoint
+	// exceptionFilters are the enabled exception breakpoint filters.
+	exceptionFilters map[string]bool
+	// configured is set once the configuration sequence has run, after
+	// which breakpoints are sent as soon as they're added.
+	configured bool
+	// currentThread is the thread that execution commands act on, and
+	// stopped reports whether it is currently stopped.
+	currentThread int
+	stopped       bool
+	// threads is the live thread list, kept up to date by thread events
+	// between threads requests. It is nil until it is first fetched.
+	threads []Thread
+	// eventWaiters are closed the next time the event they're keyed by
+	// arrives.
+	eventWaiters map[string][]chan struct{}
+	// arrived holds the events that have been handled since what they
+	// report last changed: stopped since the debuggee last ran, and
+	// terminated since it was last started.
+	arrived map[string]bool
+	// frames is the most recently fetched stack trace for currentThread,
+	// and selectedFrame indexes into it, or is -1 if no frame has been
+	// selected. Both are reset whenever the thread stops or resumes.
+	frames        []StackFrame
+	selectedFrame int
+	// watches are the expressions evaluated each time a thread stops.
+	watches []string
+	// indexedCounts maps variable references to how many indexed children
+	// the adapter said they have, for those with any. References only last
+	// while the debuggee is stopped, so it is reset along with frames.
+	indexedCounts map[int]int
+	// hexFormat is set by format hex on.
+	hexFormat bool
+	// lastCommand is the line an empty one repeats, if the last command
+	// run is one worth repeating.
+	lastCommand string
+	// modules are the debuggee's loaded modules, as of the last modules
+	// request and any module events since.
+	modules []Module
+	// sources are the sources the adapter has loaded, as of the last
+	// loadedSources request and any loadedSource events since.
+	sources []Source
+	// lastException is the exception the debuggee last stopped on, if the
+	// adapter could tell us about it.
+	lastException *ExceptionInfoResponseBody
+	// dryRun is set for a dry run's session, which no events arrive for.
+	dryRun bool
+}
+
+func newSessionState() *sessionState {
+	return &sessionState{selectedFrame: -1, capabilitiesSet: make(chan struct{})}
+}
+
+// setInitializing records that an initialize request is about to be sent,
+// so the capabilities it returns haven't been set yet.
+func (s *sessionState) setInitializing() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	select {
+	case <-s.capabilitiesSet:
+		s.capabilitiesSet = make(chan struct{})
+	default:
+	}
+}
+
+// setCapabilities records the capabilities from the initialize response.
+func (s *sessionState) setCapabilities(caps Capabilities) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.capabilities = caps
+	select {
+	case <-s.capabilitiesSet:
+	default:
+		close(s.capabilitiesSet)
+	}
+}
+
+// waitForCapabilities returns a channel that is closed once setCapabilities
+// has been called for the latest initialize request.
+func (s *sessionState) waitForCapabilities() <-chan struct{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.capabilitiesSet
+}
+
+// mergeCapabilities applies a partial capabilities update from the adapter.
+// Only the fields present in update change.
+func (s *sessionState) mergeCapabilities(update json.RawMessage) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return json.Unmarshal(update, &s.capabilities)
+}
+
+func (s *sessionState) getCapabilities() Capabilities {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.capabilities
+}
+
+func (s *sessionState) setMode(mode sessionMode) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.mode = mode
+}
+
+func (s *sessionState) getMode() sessionMode {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.mode
+}
+
+// setLaunched records that the debuggee was launched with args.
+func (s *sessionState) setLaunched(args LaunchRequestArgs) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.mode = modeLaunch
+	s.launchArgs = args
+	delete(s.arrived, "terminated")
+}
+
+// setAttached records that the client attached to the debuggee with args.
+func (s *sessionState) setAttached(args AttachRequestArgs) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.mode = modeAttach
+	s.attachArgs = args
+	delete(s.arrived, "terminated")
+}
+
+// getStartArgs returns how the session was started, and the arguments that
+// were used to do it.
+func (s *sessionState) getStartArgs() (sessionMode, LaunchRequestArgs, AttachRequestArgs) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.mode, s.launchArgs, s.attachArgs
+}
+
+// setRestarting resets the session for the adapter restarting it in place.
+// The adapter sends initialized again, and the configuration sequence runs
+// as it did the first time.
+func (s *sessionState) setRestarting() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.configured = false
+	s.currentThread = 0
+	s.stopped = false
+	s.clearFrames()
+	s.threads = nil
+	s.breakpointResults = nil
+	s.arrived = nil
+}
+
+// setTerminated resets the session once the debuggee has gone away, keeping
+// only the breakpoints. If the debuggee had been launched, it returns the
+// arguments it was launched with.
+func (s *sessionState) setTerminated() (args LaunchRequestArgs, launched bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	launched = s.mode == modeLaunch
+	s.mode = modeNone
+	s.configured = false
+	s.currentThread = 0
+	s.stopped = false
+	s.clearFrames()
+	s.modules = nil
+	s.sources = nil
+	s.lastException = nil
+	s.dataBreakpoints = nil
+	s.instructionBreakpoints = nil
+	// Breakpoints will have to be verified again by the next debuggee.
+	s.breakpointResults = nil
+	s.threads = nil
+	return s.launchArgs, launched
+}
+
+func (s *sessionState) setDryRun() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.dryRun = true
+}
+
+func (s *sessionState) setDisconnected() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.disconnected = true
+}
+
+func (s *sessionState) isDisconnected() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.disconnected
+}
+
+func (s *sessionState) setConfigured() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.configured = true
+}
+
+func (s *sessionState) isConfigured() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.configured
+}
+
+// getBreakpoints returns a copy of the source breakpoints for every file.
+func (s *sessionState) getBreakpoints() map[string][]SourceBreakpoint {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	bps := make(map[string][]SourceBreakpoint, len(s.breakpoints))
+	for path, fileBps := range s.breakpoints {
+		bps[path] = append([]SourceBreakpoint(nil), fileBps...)
+	}
+	return bps
+}
+
+// addBreakpoint adds bp to the breakpoints for path, replacing any existing
+// breakpoint on the same line, and returns the file's full set.
+func (s *sessionState) addBreakpoint(path string, bp SourceBreakpoint) []SourceBreakpoint {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.breakpoints == nil {
+		s.breakpoints = make(map[string][]SourceBreakpoint)
+	}
+	bps := s.breakpoints[path]
+	for i, existing := range bps {
+		if existing.Line == bp.Line {
+			bps[i] = bp
+			return append([]SourceBreakpoint(nil), bps...)
+		}
+	}
+	bps = append(bps, bp)
+	s.breakpoints[path] = bps
+	return append([]SourceBreakpoint(nil), bps...)
+}
+
+// removeBreakpoint removes the breakpoint on line of path, and returns the
+// file's remaining breakpoints and whether there was one to remove.
+func (s *sessionState) removeBreakpoint(path string, line int) ([]SourceBreakpoint, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	bps := s.breakpoints[path]
+	for i, bp := range bps {
+		if bp.Line == line {
+			bps = append(bps[:i], bps[i+1:]...)
+			s.setFileBreakpoints(path, bps)
+			return append([]SourceBreakpoint{}, bps...), true
+		}
+	}
+	return nil, false
+}
+
+// clearBreakpoints removes the breakpoints in path, or in every file if path
+// is empty, and returns the ones it removed.
+func (s *sessionState) clearBreakpoints(path string) map[string][]SourceBreakpoint {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	removed := make(map[string][]SourceBreakpoint)
+	for p, bps := range s.breakpoints {
+		if path == "" || p == path {
+			removed[p] = bps
+			delete(s.breakpoints, p)
+		}
+	}
+	return removed
+}
+
+// setFileBreakpoints replaces the breakpoints for path. The caller must hold
+// mu.
+func (s *sessionState) setFileBreakpoints(path string, bps []SourceBreakpoint) {
+	if len(bps) == 0 {
+		delete(s.breakpoints, path)
+		return
+	}
+	s.breakpoints[path] = bps
+}
+
+func (s *sessionState) setStopped(threadID int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.currentThread = threadID
+	s.stopped = true
+	s.clearFrames()
+}
+
+// waitForEvent returns a channel that is closed the next time the named
+// event arrives.
+func (s *sessionState) waitForEvent(event string) <-chan struct{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.addEventWaiter(event)
+}
+
+// addEventWaiter is waitForEvent for callers holding mu.
+func (s *sessionState) addEventWaiter(event string) <-chan struct{} {
+	ch := make(chan struct{})
+	if s.dryRun {
+		// No events arrive in a dry run, so there's nothing to wait for.
+		close(ch)
+		return ch
+	}
+	if s.eventWaiters == nil {
+		s.eventWaiters = make(map[string][]chan struct{})
+	}
+	s.eventWaiters[event] = append(s.eventWaiters[event], ch)
+	return ch
+}
+
+// waitUntil returns a channel that is closed once the named event has
+// arrived, which is right away if it already has since what it reports
+// last changed. Unlike waitForEvent, it can't miss an event that arrives
+// before it's called.
+func (s *sessionState) waitUntil(event string) <-chan struct{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.arrived[event] {
+		ch := make(chan struct{})
+		close(ch)
+		return ch
+	}
+	return s.addEventWaiter(event)
+}
+
+// waitForStop returns a channel that is closed the next time a thread stops.
+func (s *sessionState) waitForStop() <-chan struct{} {
+	return s.waitForEvent("stopped")
+}
+
+// notifyEvent wakes everything waiting for the named event. It is called
+// once the event has been handled.
+func (s *sessionState) notifyEvent(event string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, ch := range s.eventWaiters[event] {
+		close(ch)
+	}
+	delete(s.eventWaiters, event)
+	if s.arrived == nil {
+		s.arrived = make(map[string]bool)
+	}
+	s.arrived[event] = true
+}
+
+func (s *sessionState) setRunning() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.arrived, "stopped")
+	s.stopped = false
+	s.clearFrames()
+}
+
+// setCurrentThread changes which thread execution commands act on.
+func (s *sessionState) setCurrentThread(threadID int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.currentThread != threadID {
+		s.currentThread = threadID
+		s.clearFrames()
+	}
+}
+
+func (s *sessionState) setThreads(threads []Thread) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.threads = append([]Thread{}, threads...)
+}
+
+// getThreads returns the live thread list, and whether it can be trusted
+// without asking the adapter: it must have been fetched, and every thread
+// that has started since must have been named by a later fetch.
+func (s *sessionState) getThreads() ([]Thread, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.threads == nil {
+		return nil, false
+	}
+	for _, t := range s.threads {
+		if t.Name == "" {
+			return nil, false
+		}
+	}
+	return append([]Thread(nil), s.threads...), true
+}
+
+// threadStarted adds a thread to the live thread list.
+func (s *sessionState) threadStarted(threadID int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, t := range s.threads {
+		if t.ID == threadID {
+			return
+		}
+	}
+	s.threads = append(s.threads, Thread{ID: threadID})
+}
+
+// threadExited removes a thread from the live thread list, and reports
+// whether it was the current thread, which is then cleared.
+func (s *sessionState) threadExited(threadID int) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, t := range s.threads {
+		if t.ID == threadID {
+			s.threads = append(s.threads[:i], s.threads[i+1:]...)
+			break
+		}
+	}
+	if s.currentThread != threadID {
+		return false
+	}
+	s.currentThread = 0
+	s.stopped = false
+	s.clearFrames()
+	return true
+}
+
+func (s *sessionState) getCurrentThread() (threadID int, stopped bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.currentThread, s.stopped
+}
+
+func (s *sessionState) clearFrames() {
+	s.frames = nil
+	s.selectedFrame = -1
+	s.indexedCounts = nil
+}
+
+// setFrames records the latest stack trace for the current thread.
+func (s *sessionState) setFrames(frames []StackFrame) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.frames = frames
+	if s.selectedFrame >= len(frames) {
+		s.selectedFrame = -1
+	}
+}
+
+// setStopFrames records the stack trace fetched when threadID stopped, unless
+// it has resumed or a trace has been recorded since.
+func (s *sessionState) setStopFrames(threadID int, frames []StackFrame) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.stopped && s.currentThread == threadID && s.frames == nil {
+		s.frames = frames
+	}
+}
+
+func (s *sessionState) getFrames() []StackFrame {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.frames
+}
+
+// selectFrame selects the frame at index i in the last stack trace.
+func (s *sessionState) selectFrame(i int) (StackFrame, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if i < 0 || i >= len(s.frames) {
+		return StackFrame{}, false
+	}
+	s.selectedFrame = i
+	return s.frames[i], true
+}
+
+// getSelectedFrame returns the selected frame, if there is one.
+func (s *sessionState) getSelectedFrame() (StackFrame, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.selectedFrame < 0 {
+		return StackFrame{}, false
+	}
+	return s.frames[s.selectedFrame], true
+}
+
+// addFunctionBreakpoint adds bp to the function breakpoints, replacing any
+// existing one for the same function, and returns the full set.
+func (s *sessionState) addFunctionBreakpoint(bp FunctionBreakpoint) []FunctionBreakpoint {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	replaced := false
+	for i, existing := range s.functionBreakpoints {
+		if existing.Name == bp.Name {
+			s.functionBreakpoints[i] = bp
+			replaced = true
+		}
+	}
+	if !replaced {
+		s.functionBreakpoints = append(s.functionBreakpoints, bp)
+	}
+	return append([]FunctionBreakpoint(nil), s.functionBreakpoints...)
+}
+
+// copyBreakpoints gives s the source and function breakpoints and the
+// exception filters set in from.
+func (s *sessionState) copyBreakpoints(from *sessionState) {
+	bps := from.getBreakpoints()
+	functionBps := from.getFunctionBreakpoints()
+	filters := from.getExceptionFilters()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.breakpoints = bps
+	s.functionBreakpoints = functionBps
+	s.exceptionFilters = make(map[string]bool, len(filters))
+	for _, filter := range filters {
+		s.exceptionFilters[filter] = true
+	}
+}
+
+func (s *sessionState) getFunctionBreakpoints() []FunctionBreakpoint {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]FunctionBreakpoint(nil), s.functionBreakpoints...)
+}
+
+type reportedBreakpoint struct {
+	Breakpoint
+	where string
+}
+
+// setBreakpointStatus records the adapter's response for a breakpoint set at
+// where.
+func (s *sessionState) setBreakpointStatus(bp Breakpoint, where string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if bp.ID == 0 {
+		// Without an ID, later events can't refer to it.
+		return
+	}
+	if s.breakpointStatus == nil {
+		s.breakpointStatus = make(map[int]reportedBreakpoint)
+	}
+	s.breakpointStatus[bp.ID] = reportedBreakpoint{Breakpoint: bp, where: where}
+}
+
+// updateBreakpointStatus applies a breakpoint event, returning where the
+// breakpoint was set and whether it was verified before, if it was known.
+func (s *sessionState) updateBreakpointStatus(reason string, bp Breakpoint) (where string, wasVerified, known bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	prev, known := s.breakpointStatus[bp.ID]
+	if reason == "removed" {
+		delete(s.breakpointStatus, bp.ID)
+		return prev.where, prev.Verified, known
+	}
+	if s.breakpointStatus == nil {
+		s.breakpointStatus = make(map[int]reportedBreakpoint)
+	}
+	s.breakpointStatus[bp.ID] = reportedBreakpoint{Breakpoint: bp, where: prev.where}
+	for _, results := range s.breakpointResults {
+		for i := range results {
+			if results[i].ID == bp.ID {
+				results[i] = bp
+			}
+		}
+	}
+	return prev.where, prev.Verified, known
+}
+
+// setBreakpointResults records the adapter's response to setting the
+// breakpoints under key.
+func (s *sessionState) setBreakpointResults(key string, results []Breakpoint) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.breakpointResults == nil {
+		s.breakpointResults = make(map[string][]Breakpoint)
+	}
+	s.breakpointResults[key] = append([]Breakpoint(nil), results...)
+}
+
+// breakpointResult returns what the adapter said about the ith breakpoint
+// under key, if it has said anything.
+func (s *sessionState) breakpointResult(key string, i int) (Breakpoint, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	results := s.breakpointResults[key]
+	if i >= len(results) {
+		return Breakpoint{}, false
+	}
+	return results[i], true
+}
+
+// removeFunctionBreakpoint removes the breakpoint on the named function and
+// returns the rest.
+func (s *sessionState) removeFunctionBreakpoint(name string) []FunctionBreakpoint {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, bp := range s.functionBreakpoints {
+		if bp.Name == name {
+			s.functionBreakpoints = append(s.functionBreakpoints[:i], s.functionBreakpoints[i+1:]...)
+			break
+		}
+	}
+	return append([]FunctionBreakpoint{}, s.functionBreakpoints...)
+}
+
+func (s *sessionState) getDataBreakpoints() []DataBreakpoint {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]DataBreakpoint(nil), s.dataBreakpoints...)
+}
+
+// removeDataBreakpoint removes the breakpoint on dataID and returns the rest.
+func (s *sessionState) removeDataBreakpoint(dataID string) []DataBreakpoint {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, bp := range s.dataBreakpoints {
+		if bp.DataID == dataID {
+			s.dataBreakpoints = append(s.dataBreakpoints[:i], s.dataBreakpoints[i+1:]...)
+			break
+		}
+	}
+	return append([]DataBreakpoint{}, s.dataBreakpoints...)
+}
+
+func (s *sessionState) getInstructionBreakpoints() []InstructionBreakpoint {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]InstructionBreakpoint(nil), s.instructionBreakpoints...)
+}
+
+// removeInstructionBreakpoint removes the ith instruction breakpoint and
+// returns the rest.
+func (s *sessionState) removeInstructionBreakpoint(i int) []InstructionBreakpoint {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if i >= 0 && i < len(s.instructionBreakpoints) {
+		s.instructionBreakpoints = append(s.instructionBreakpoints[:i], s.instructionBreakpoints[i+1:]...)
+	}
+	return append([]InstructionBreakpoint{}, s.instructionBreakpoints...)
+}
+
+// addDataBreakpoint adds bp to the data breakpoints, replacing any existing
+// one for the same data, and returns the full set.
+func (s *sessionState) addDataBreakpoint(bp DataBreakpoint) []DataBreakpoint {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	replaced := false
+	for i, existing := range s.dataBreakpoints {
+		if existing.DataID == bp.DataID {
+			s.dataBreakpoints[i] = bp
+			replaced = true
+		}
+	}
+	if !replaced {
+		s.dataBreakpoints = append(s.dataBreakpoints, bp)
+	}
+	return append([]DataBreakpoint(nil), s.dataBreakpoints...)
+}
+
+// addInstructionBreakpoint adds bp to the instruction breakpoints, replacing
+// any existing one for the same instruction, and returns the full set.
+func (s *sessionState) addInstructionBreakpoint(bp InstructionBreakpoint) []InstructionBreakpoint {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	replaced := false
+	for i, existing := range s.instructionBreakpoints {
+		if existing.InstructionReference == bp.InstructionReference && existing.Offset == bp.Offset {
+			s.instructionBreakpoints[i] = bp
+			replaced = true
+		}
+	}
+	if !replaced {
+		s.instructionBreakpoints = append(s.instructionBreakpoints, bp)
+	}
+	return append([]InstructionBreakpoint(nil), s.instructionBreakpoints...)
+}
+
+// toggleExceptionFilter enables the exception breakpoint filter if it was
+// disabled and vice versa, reporting whether it is now enabled.
+func (s *sessionState) toggleExceptionFilter(filter string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.exceptionFilters == nil {
+		s.exceptionFilters = make(map[string]bool)
+	}
+	if s.exceptionFilters[filter] {
+		delete(s.exceptionFilters, filter)
+		return false
+	}
+	s.exceptionFilters[filter] = true
+	return true
+}
+
+// getExceptionFilters returns the enabled exception breakpoint filters.
+func (s *sessionState) getExceptionFilters() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	filters := make([]string, 0, len(s.exceptionFilters))
+	for filter := range s.exceptionFilters {
+		filters = append(filters, filter)
+	}
+	sort.Strings(filters)
+	return filters
+}
+
+func (s *sessionState) addWatch(expr string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.watches = append(s.watches, expr)
+}
+
+func (s *sessionState) getWatches() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.watches...)
+}
+
+// removeWatch removes the nth watch expression, counting from 1, and reports
+// whether there was one.
+func (s *sessionState) removeWatch(n int) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if n < 1 || n > len(s.watches) {
+		return false
+	}
+	s.watches = append(s.watches[:n-1], s.watches[n:]...)
+	return true
+}
+
+// setIndexedCounts records how many indexed children each of vars has.
+func (s *sessionState) setIndexedCounts(vars []Variable) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, v := range vars {
+		if v.VariablesReference == 0 || v.IndexedVariables == 0 {
+			continue
+		}
+		if s.indexedCounts == nil {
+			s.indexedCounts = make(map[int]int)
+		}
+		s.indexedCounts[v.VariablesReference] = v.IndexedVariables
+	}
+}
+
+func (s *sessionState) indexedCount(ref int) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.indexedCounts[ref]
+}
+
+func (s *sessionState) setHexFormat(hex bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.hexFormat = hex
+}
+
+func (s *sessionState) getHexFormat() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.hexFormat
+}
+
+func (s *sessionState) setLastCommand(line string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lastCommand = line
+}
+
+func (s *sessionState) getLastCommand() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.lastCommand
+}
+
+func (s *sessionState) setModules(modules []Module) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.modules = modules
+}
+
+func (s *sessionState) getModules() []Module {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Module(nil), s.modules...)
+}
+
+// updateModule applies a module event, where reason is one of added,
+// changed, or removed.
+func (s *sessionState) updateModule(reason string, m Module) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, existing := range s.modules {
+		if existing.ID != m.ID {
+			continue
+		}
+		if reason == "removed" {
+			s.modules = append(s.modules[:i], s.modules[i+1:]...)
+		} else {
+			s.modules[i] = m
+		}
+		return
+	}
+	if reason != "removed" {
+		s.modules = append(s.modules, m)
+	}
+}
+
+func (s *sessionState) setSources(sources []Source) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sources = sources
+}
+
+func (s *sessionState) getSources() []Source {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Source(nil), s.sources...)
+}
+
+// updateSource applies a loadedSource event, where reason is one of new,
+// changed, or removed. Sources are matched by path, or by reference if they
+// have no path.
+func (s *sessionState) updateSource(reason string, src Source) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, existing := range s.sources {
+		same := existing.Path == src.Path
+		if src.Path == "" {
+			same = existing.SourceReference == src.SourceReference
+		}
+		if !same {
+			continue
+		}
+		if reason == "removed" {
+			s.sources = append(s.sources[:i], s.sources[i+1:]...)
+		} else {
+			s.sources[i] = src
+		}
+		return
+	}
+	if reason != "removed" {
+		s.sources = append(s.sources, src)
+	}
+}
+
+func (s *sessionState) setLastException(info ExceptionInfoResponseBody) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lastException = &info
+}
+
+func (s *sessionState) getLastException() (ExceptionInfoResponseBody, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.lastException == nil {
+		return ExceptionInfoResponseBody{}, false
+	}
+	return *s.lastException, true
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"strconv"
+	"sync"
+)
+
+// Session is a connection to one debug adapter, along with the requests
+// awaiting its responses and what the client knows about its debuggee.
+// Commands are given the session to talk to the adapter over, and events are
+// handled with the session they came from.
+type Session struct {
+	*Client
+	*sessionState
+	ID   int
+	opts *Options
+	// reconnect opens another connection to the adapter, for the child
+	// sessions it asks for. It is nil if there's no way to.
+	reconnect func() (io.ReadWriteCloser, error)
+}
+
+// sessions holds every session the client has started, and which one the
+// REPL is talking to.
+var sessions struct {
+	mu      sync.Mutex
+	list    []*Session
+	current *Session
+}
+
+// newSession starts a session with the adapter cl is connected to, running
+// with opts. The first one becomes the current session.
+func newSession(cl *Client, opts *Options) *Session {
+	sessions.mu.Lock()
+	defer sessions.mu.Unlock()
+	s := &Session{
+		Client:       cl,
+		sessionState: newSessionState(),
+		ID:           len(sessions.list),
+		opts:         opts,
+	}
+	sessions.list = append(sessions.list, s)
+	if sessions.current == nil {
+		sessions.current = s
+	}
+	return s
+}
+
+func currentSession() *Session {
+	sessions.mu.Lock()
+	defer sessions.mu.Unlock()
+	return sessions.current
+}
+
+// switchSession makes the session with the given ID current, so that the
+// REPL's commands go to it.
+func switchSession(id int) bool {
+	sessions.mu.Lock()
+	defer sessions.mu.Unlock()
+	if id < 0 || id >= len(sessions.list) {
+		return false
+	}
+	sessions.current = sessions.list[id]
+	return true
+}
+
+// startChildSession starts the session the adapter asked for with a
+// startDebugging request, over a new connection, and makes it current. The
+// child starts out with its parent's breakpoints, so that it stops wherever
+// the parent would have.
+func startChildSession(parent *Session, args StartDebuggingArgs) error {
+	conn, err := parent.reconnect()
+	if err != nil {
+		return err
+	}
+	cl := NewClient(conn)
+	cl.Timeout = parent.Timeout
+	child := newSession(cl, parent.opts)
+	child.reconnect = parent.reconnect
+	child.copyBreakpoints(parent.sessionState)
+	go func() {
+		if err := child.Listen(child); err != nil {
+			log.Printf("session %d: %s", child.ID, err)
+		}
+		fmt.Fprintf(child.opts.Out, "session %d ended\n", child.ID)
+		// The REPL goes back to the parent rather than talking to a
+		// session that's gone.
+		sessions.mu.Lock()
+		if sessions.current == child {
+			sessions.current = parent
+		}
+		sessions.mu.Unlock()
+	}()
+
+	if _, err := sendInitialize(child); err != nil {
+		child.setDisconnected()
+		child.Close()
+		return err
+	}
+	switch args.Request {
+	case "launch":
+		launchArgs := LaunchRequestArgs{Raw: args.Configuration}
+		launchArgs.Program, _ = args.Configuration["program"].(string)
+		err = launchSession(child, launchArgs)
+	case "attach":
+		err = attachSession(child, AttachRequestArgs{Raw: args.Configuration})
+	}
+	if err != nil {
+		child.setDisconnected()
+		child.Close()
+		return err
+	}
+	fmt.Fprintf(child.opts.Out, "started session %d, which is now current: %s\n", child.ID, child.describe())
+	switchSession(child.ID)
+	return nil
+}
+
+func (s *Session) onEvent(event Event) { handleEvent(s, event) }
+
+func (s *Session) onRequest(req ReverseRequest) { handleReverseRequest(s, req) }
+
+func (s *Session) closing() bool { return s.isDisconnected() }
+
+// describe summarizes what the session is debugging.
+func (s *Session) describe() string {
+	mode, launchArgs, attachArgs := s.getStartArgs()
+	switch mode {
+	case modeLaunch:
+		return "launched " + launchArgs.Program
+	case modeAttach:
+		if attachArgs.ProcessID != 0 {
+			return fmt.Sprintf("attached to pid %d", attachArgs.ProcessID)
+		}
+		return "attached"
+	}
+	if s.isDisconnected() {
+		return "disconnected"
+	}
+	return "not started"
+}
+
+func sessionCommand(s *Session, args []string) error {
+	if len(args) == 0 || args[0] == "list" {
+		sessions.mu.Lock()
+		list := append([]*Session(nil), sessions.list...)
+		sessions.mu.Unlock()
+		for _, other := range list {
+			mark := " "
+			if other == s {
+				mark = "*"
+			}
+			fmt.Fprintf(s.opts.Out, "%s %d: %s\n", mark, other.ID, other.describe())
+		}
+		return nil
+	}
+	if args[0] != "switch" || len(args) != 2 {
+		return errors.New("usage: session [list | switch <id>]")
+	}
+	id, err := strconv.Atoi(args[1])
+	if err != nil {
+		return fmt.Errorf("bad session ID %q", args[1])
+	}
+	if !switchSession(id) {
+		return fmt.Errorf("no session %d", id)
+	}
+	fmt.Fprintf(s.opts.Out, "switched to session %d\n", id)
+	return nil
+}
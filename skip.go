@@ -0,0 +1,104 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strconv"
+)
+
+// maxSkipSteps is how many times in a row step will step out of skipped
+// code before giving up and leaving the thread where it is.
+const maxSkipSteps = 10
+
+// skipPattern returns the pattern in StepIntoFilter that path matches, if
+// any. A pattern matches a path if it matches the whole path or one of the
+// directories it's in, so /usr/local/go/src/* skips the standard library.
+// A pattern without a separator may also match the file name alone.
+func skipPattern(s *Session, path string) (string, bool) {
+	if path == "" {
+		return "", false
+	}
+	for _, pattern := range s.opts.StepIntoFilter {
+		if !containsSeparator(pattern) {
+			if ok, _ := filepath.Match(pattern, filepath.Base(path)); ok {
+				return pattern, true
+			}
+		}
+		for p := path; ; p = filepath.Dir(p) {
+			if ok, _ := filepath.Match(pattern, p); ok {
+				return pattern, true
+			}
+			if filepath.Dir(p) == p {
+				break
+			}
+		}
+	}
+	return "", false
+}
+
+func containsSeparator(pattern string) bool {
+	for _, r := range pattern {
+		if r == '/' || r == filepath.Separator {
+			return true
+		}
+	}
+	return false
+}
+
+// skipFiltered steps the thread out of code that StepIntoFilter says to
+// skip, until it stops somewhere that isn't, or maxSkipSteps is reached.
+func skipFiltered(s *Session) error {
+	for i := 0; i < maxSkipSteps; i++ {
+		frames, err := cachedFrames(s)
+		if err != nil || len(frames) == 0 || frames[0].Source == nil {
+			return err
+		}
+		pattern, ok := skipPattern(s, frames[0].Source.Path)
+		if !ok {
+			return nil
+		}
+		fmt.Fprintf(s.opts.Out, "skipping %s (matches %s)\n", frames[0].Source.Path, pattern)
+		stopped, err := step(s, nil, func(threadID int, granularity string) Request {
+			return StepOutRequest(StepOutArgs{ThreadID: threadID, Granularity: granularity})
+		})
+		if err != nil || !stopped {
+			return err
+		}
+	}
+	fmt.Fprintf(s.opts.Out, "still in skipped code after stepping out %d times; stopping here\n", maxSkipSteps)
+	return nil
+}
+
+func skipCommand(s *Session, args []string) error {
+	if len(args) == 0 || args[0] == "list" {
+		if len(s.opts.StepIntoFilter) == 0 {
+			fmt.Fprintln(s.opts.Out, "no skip patterns")
+			return nil
+		}
+		for i, pattern := range s.opts.StepIntoFilter {
+			fmt.Fprintf(s.opts.Out, "%d: %s\n", i+1, pattern)
+		}
+		return nil
+	}
+	switch {
+	case args[0] == "add" && len(args) == 2:
+		if _, err := filepath.Match(args[1], ""); err != nil {
+			return fmt.Errorf("bad pattern %q: %s", args[1], err)
+		}
+		s.opts.StepIntoFilter = append(s.opts.StepIntoFilter, args[1])
+		fmt.Fprintf(s.opts.Out, "skip pattern %d added\n", len(s.opts.StepIntoFilter))
+	case args[0] == "del" && len(args) == 2:
+		n, err := strconv.Atoi(args[1])
+		if err != nil {
+			return fmt.Errorf("bad skip pattern number %q", args[1])
+		}
+		if n < 1 || n > len(s.opts.StepIntoFilter) {
+			return fmt.Errorf("no skip pattern %d", n)
+		}
+		s.opts.StepIntoFilter = append(s.opts.StepIntoFilter[:n-1], s.opts.StepIntoFilter[n:]...)
+	default:
+		return errors.New("usage: skip [list | add <glob> | del <n>]")
+	}
+	return nil
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// defaultListContext is the number of lines list shows on each side of the
+// current line when not told otherwise.
+const defaultListContext = 5
+
+type SourceArgs struct {
+	Source          *Source `json:"source,omitempty"`
+	SourceReference int     `json:"sourceReference"`
+}
+
+type SourceResponseBody struct {
+	Content  string `json:"content"`
+	MimeType string `json:"mimeType,omitempty"`
+}
+
+func SourceRequest(args SourceArgs) Request {
+	return Request{
+		ProtocolMessage: NewRequest(),
+		Command:         "source",
+		Arguments:       args,
+	}
+}
+
+type LoadedSourcesResponseBody struct {
+	Sources []Source `json:"sources"`
+}
+
+type LoadedSourceEventBody struct {
+	Reason string `json:"reason"`
+	Source Source `json:"source"`
+}
+
+func LoadedSourcesRequest() Request {
+	return Request{
+		ProtocolMessage: NewRequest(),
+		Command:         "loadedSources",
+	}
+}
+
+// sourceContent returns the contents of src, reading it from disk if it has
+// a path, or asking the adapter for it otherwise.
+func sourceContent(s *Session, src *Source) (string, error) {
+	if src.Path != "" {
+		b, err := os.ReadFile(src.Path)
+		if err == nil || src.SourceReference == 0 {
+			return string(b), err
+		}
+	}
+	if src.SourceReference == 0 {
+		return "", fmt.Errorf("no path or reference for source %s", src.Name)
+	}
+	resp, err := sendAndWait(s, SourceRequest(SourceArgs{Source: src, SourceReference: src.SourceReference}))
+	if err != nil {
+		return "", err
+	}
+	var body SourceResponseBody
+	if err := json.Unmarshal(resp.Body, &body); err != nil {
+		return "", fmt.Errorf("failed to read source: %s", err)
+	}
+	return body.Content, nil
+}
+
+func listCommand(s *Session, args []string) error {
+	context := defaultListContext
+	if len(args) > 0 {
+		n, err := strconv.Atoi(args[0])
+		if err != nil || n < 0 {
+			return fmt.Errorf("bad line count %q", args[0])
+		}
+		context = n
+	}
+	frame, err := currentFrame(s)
+	if err != nil {
+		return err
+	}
+	if frame.Source == nil {
+		return fmt.Errorf("no source for %s", frame.Name)
+	}
+	content, err := sourceContent(s, frame.Source)
+	if err != nil {
+		return err
+	}
+	lines := strings.Split(strings.TrimSuffix(content, "\n"), "\n")
+	current := displayLine(s, frame.Line)
+	first, last := current-context, current+context
+	if first < 1 {
+		first = 1
+	}
+	if last > len(lines) {
+		last = len(lines)
+	}
+	if first > last {
+		return fmt.Errorf("line %d is past the end of the source (%d lines)", current, len(lines))
+	}
+	width := len(strconv.Itoa(last))
+	for n := first; n <= last; n++ {
+		text := fmt.Sprintf("%*d  %s", width, n, lines[n-1])
+		if n == current {
+			fmt.Fprintln(s.opts.Out, colorize(colorGreen, "=> "+text))
+		} else {
+			fmt.Fprintln(s.opts.Out, "   "+text)
+		}
+	}
+	return nil
+}
+
+func handleLoadedSourceEvent(s *Session, event Event) {
+	var body LoadedSourceEventBody
+	if err := json.Unmarshal(event.Body, &body); err != nil {
+		log.Printf("failed to read loadedSource event: %s", err)
+		return
+	}
+	s.updateSource(body.Reason, body.Source)
+}
+
+func sourcesCommand(s *Session, args []string) error {
+	var sources []Source
+	if checkSupported(s, "loadedSources") == nil {
+		resp, err := sendAndWait(s, LoadedSourcesRequest())
+		if err != nil {
+			return err
+		}
+		var body LoadedSourcesResponseBody
+		if err := json.Unmarshal(resp.Body, &body); err != nil {
+			return fmt.Errorf("failed to read loaded sources: %s", err)
+		}
+		sources = body.Sources
+		s.setSources(sources)
+	} else {
+		// Fall back to what loadedSource events have told us.
+		sources = s.getSources()
+	}
+	if len(sources) == 0 {
+		fmt.Fprintln(s.opts.Out, "no sources")
+		return nil
+	}
+	for _, src := range sources {
+		switch {
+		case src.Path != "":
+			fmt.Fprintln(s.opts.Out, src.Path)
+		case src.SourceReference != 0:
+			fmt.Fprintf(s.opts.Out, "%s [ref %d]\n", src.Name, src.SourceReference)
+		default:
+			fmt.Fprintln(s.opts.Out, src.Name)
+		}
+	}
+	return nil
+}
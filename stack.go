@@ -0,0 +1,205 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+// defaultStackLevels is the number of frames bt fetches when not told
+// otherwise.
+const defaultStackLevels = 20
+
+type StackFrame struct {
+	ID     int     `json:"id"`
+	Name   string  `json:"name"`
+	Source *Source `json:"source"`
+	Line   int     `json:"line"`
+	Column int     `json:"column"`
+	// InstructionPointerReference is the memory reference of the frame's
+	// current instruction, if the adapter knows it.
+	InstructionPointerReference string `json:"instructionPointerReference,omitempty"`
+}
+
+type StackTraceArgs struct {
+	ThreadID   int          `json:"threadId"`
+	StartFrame int          `json:"startFrame,omitempty"`
+	Levels     int          `json:"levels,omitempty"`
+	Format     *ValueFormat `json:"format,omitempty"`
+}
+
+type StackTraceResponseBody struct {
+	StackFrames []StackFrame `json:"stackFrames"`
+	TotalFrames int          `json:"totalFrames"`
+}
+
+type RestartFrameArgs struct {
+	FrameID int `json:"frameId"`
+}
+
+func RestartFrameRequest(args RestartFrameArgs) Request {
+	return Request{
+		ProtocolMessage: NewRequest(),
+		Command:         "restartFrame",
+		Arguments:       args,
+	}
+}
+
+func StackTraceRequest(args StackTraceArgs) Request {
+	return Request{
+		ProtocolMessage: NewRequest(),
+		Command:         "stackTrace",
+		Arguments:       args,
+	}
+}
+
+// formatLocation renders a source location as file:line, or just the line
+// if the source is unknown. The line is as reported by the adapter.
+func formatLocation(s *Session, src *Source, line int) string {
+	line = displayLine(s, line)
+	if src == nil {
+		return fmt.Sprintf("line %d", line)
+	}
+	name := src.Name
+	if name == "" {
+		name = src.Path
+	}
+	return fmt.Sprintf("%s:%d", name, line)
+}
+
+func stackTrace(s *Session, threadID, levels int) ([]StackFrame, error) {
+	req := StackTraceRequest(StackTraceArgs{ThreadID: threadID, Levels: levels, Format: valueFormat(s)})
+	resp, err := sendAndWait(s, req)
+	if err != nil {
+		return nil, err
+	}
+	var body StackTraceResponseBody
+	if err := json.Unmarshal(resp.Body, &body); err != nil {
+		return nil, fmt.Errorf("failed to read stack trace: %s", err)
+	}
+	return body.StackFrames, nil
+}
+
+func backtraceCommand(s *Session, args []string) error {
+	threadID, stopped := s.getCurrentThread()
+	if !stopped {
+		return errors.New("no thread is stopped")
+	}
+	frames := s.getFrames()
+	if len(args) > 0 || len(frames) == 0 {
+		levels := defaultStackLevels
+		if len(args) > 0 {
+			n, err := strconv.Atoi(args[0])
+			if err != nil || n <= 0 {
+				return fmt.Errorf("bad frame count %q", args[0])
+			}
+			levels = n
+		}
+		var err error
+		if frames, err = stackTrace(s, threadID, levels); err != nil {
+			return err
+		}
+		s.setFrames(frames)
+	}
+	if s.opts.JSON {
+		printResult(s, "bt", frames, nil)
+		return nil
+	}
+	printFrames(s, frames)
+	return nil
+}
+
+func printFrames(s *Session, frames []StackFrame) {
+	for i, frame := range frames {
+		fmt.Fprintf(s.opts.Out, "#%d %s at %s\n", i, frame.Name, formatLocation(s, frame.Source, frame.Line))
+	}
+}
+
+// currentFrame returns the selected frame, or the top frame of the current
+// thread if none has been selected.
+func currentFrame(s *Session) (StackFrame, error) {
+	if frame, ok := s.getSelectedFrame(); ok {
+		return frame, nil
+	}
+	threadID, stopped := s.getCurrentThread()
+	if !stopped {
+		return StackFrame{}, fmt.Errorf("no thread is stopped")
+	}
+	frames := s.getFrames()
+	if len(frames) == 0 {
+		var err error
+		if frames, err = stackTrace(s, threadID, defaultStackLevels); err != nil {
+			return StackFrame{}, err
+		}
+		s.setFrames(frames)
+	}
+	if len(frames) == 0 {
+		return StackFrame{}, fmt.Errorf("no stack frames")
+	}
+	return frames[0], nil
+}
+
+// cachedFrames returns the last stack trace for the current thread, fetching
+// it if there isn't one.
+func cachedFrames(s *Session) ([]StackFrame, error) {
+	if frames := s.getFrames(); len(frames) > 0 {
+		return frames, nil
+	}
+	threadID, stopped := s.getCurrentThread()
+	if !stopped {
+		return nil, fmt.Errorf("no thread is stopped")
+	}
+	frames, err := stackTrace(s, threadID, defaultStackLevels)
+	if err != nil {
+		return nil, err
+	}
+	s.setFrames(frames)
+	return frames, nil
+}
+
+func frameCommand(s *Session, args []string) error {
+	if len(args) != 1 {
+		return errors.New("usage: frame <n>")
+	}
+	i, err := strconv.Atoi(args[0])
+	if err != nil {
+		return fmt.Errorf("bad frame index %q", args[0])
+	}
+	if _, err := cachedFrames(s); err != nil {
+		return err
+	}
+	frame, ok := s.selectFrame(i)
+	if !ok {
+		return fmt.Errorf("no frame %d in the last stack trace", i)
+	}
+	fmt.Fprintf(s.opts.Out, "#%d %s at %s\n", i, frame.Name, formatLocation(s, frame.Source, frame.Line))
+	return nil
+}
+
+func restartFrameCommand(s *Session, args []string) error {
+	if len(args) != 1 {
+		return errors.New("usage: restart-frame <n>")
+	}
+	i, err := strconv.Atoi(args[0])
+	if err != nil {
+		return fmt.Errorf("bad frame index %q", args[0])
+	}
+	if err := checkSupported(s, "restartFrame"); err != nil {
+		return err
+	}
+	frames, err := cachedFrames(s)
+	if err != nil {
+		return err
+	}
+	if i < 0 || i >= len(frames) {
+		return fmt.Errorf("no frame %d in the last stack trace", i)
+	}
+	frameID := frames[i].ID
+	// The thread stops again at the start of the frame, which is reported
+	// like any other stop.
+	_, err = step(s, nil, func(threadID int, granularity string) Request {
+		return RestartFrameRequest(RestartFrameArgs{FrameID: frameID})
+	})
+	return err
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+)
+
+type Thread struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+}
+
+type ThreadsResponseBody struct {
+	Threads []Thread `json:"threads"`
+}
+
+func ThreadsRequest() Request {
+	return Request{
+		ProtocolMessage: NewRequest(),
+		Command:         "threads",
+	}
+}
+
+func threads(s *Session) ([]Thread, error) {
+	req := ThreadsRequest()
+	resp, err := sendAndWait(s, req)
+	if err != nil {
+		return nil, err
+	}
+	var body ThreadsResponseBody
+	if err := json.Unmarshal(resp.Body, &body); err != nil {
+		return nil, fmt.Errorf("failed to read threads: %s", err)
+	}
+	s.setThreads(body.Threads)
+	return body.Threads, nil
+}
+
+// ThreadEventBody is the body of the thread event. Reason is started or
+// exited.
+type ThreadEventBody struct {
+	Reason   string `json:"reason"`
+	ThreadID int    `json:"threadId"`
+}
+
+func handleThreadEvent(s *Session, event Event) {
+	var body ThreadEventBody
+	if err := json.Unmarshal(event.Body, &body); err != nil {
+		log.Printf("failed to read thread event: %s", err)
+		return
+	}
+	switch body.Reason {
+	case "started":
+		s.threadStarted(body.ThreadID)
+	case "exited":
+		if s.threadExited(body.ThreadID) {
+			fmt.Fprintf(s.opts.Out, "current thread %d exited; use threads and thread <id> to pick another\n", body.ThreadID)
+		}
+	}
+}
+
+func threadsCommand(s *Session, args []string) error {
+	// Thread events keep the list current, so it only needs fetching to
+	// learn the names of new threads.
+	list, ok := s.getThreads()
+	if !ok {
+		var err error
+		if list, err = threads(s); err != nil {
+			return err
+		}
+	}
+	if s.opts.JSON {
+		printResult(s, "threads", list, nil)
+		return nil
+	}
+	if len(list) == 0 {
+		fmt.Fprintln(s.opts.Out, "no threads")
+		return nil
+	}
+	current, _ := s.getCurrentThread()
+	for _, t := range list {
+		marker := " "
+		if t.ID == current {
+			marker = "*"
+		}
+		fmt.Fprintf(s.opts.Out, "%s %d %s\n", marker, t.ID, t.Name)
+	}
+	return nil
+}
+
+func threadCommand(s *Session, args []string) error {
+	if len(args) != 1 {
+		return errors.New("usage: thread <id>")
+	}
+	id, err := strconv.Atoi(args[0])
+	if err != nil {
+		return fmt.Errorf("bad thread id %q", args[0])
+	}
+	s.setCurrentThread(id)
+	fmt.Fprintf(s.opts.Out, "switched to thread %d\n", id)
+	return nil
+}
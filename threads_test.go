@@ -0,0 +1,46 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+)
+
+func TestThreadEvents(t *testing.T) {
+	s := &Session{sessionState: newSessionState(), opts: newOptions()}
+	out := captureOutput(s)
+	s.setThreads([]Thread{{ID: 1, Name: "main"}})
+	thread := func(reason string, id int) {
+		body := fmt.Sprintf(`{"reason": %q, "threadId": %d}`, reason, id)
+		handleEvent(s, Event{Event: "thread", Body: json.RawMessage(body)})
+	}
+
+	thread("started", 2)
+	thread("started", 3)
+	thread("started", 3)
+	s.setStopped(3)
+	thread("exited", 2)
+	if out.Len() > 0 {
+		t.Errorf("printed %q when a thread other than the current one exited", out.String())
+	}
+	thread("exited", 3)
+	if want := "current thread 3 exited; use threads and thread <id> to pick another\n"; out.String() != want {
+		t.Errorf("printed %q, want %q", out.String(), want)
+	}
+
+	if fmt.Sprint(s.threads) != fmt.Sprint([]Thread{{ID: 1, Name: "main"}}) {
+		t.Errorf("threads %v, want only thread 1", s.threads)
+	}
+	if id, stopped := s.getCurrentThread(); id != 0 || stopped {
+		t.Errorf("current thread %d (stopped %v) after it exited, want none", id, stopped)
+	}
+}
+
+func TestStartedThreadNeedsName(t *testing.T) {
+	s := &Session{sessionState: newSessionState(), opts: newOptions()}
+	s.setThreads([]Thread{{ID: 1, Name: "main"}})
+	s.threadStarted(2)
+	if _, ok := s.getThreads(); ok {
+		t.Error("thread list trusted before the new thread's name is known")
+	}
+}
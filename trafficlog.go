@@ -0,0 +1,50 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// trafficLog, if set, receives every message sent to or received from the
+// adapter. Messages are logged verbatim, so anything sensitive in them, such
+// as environment variables in launch arguments, will appear in the log.
+var (
+	trafficLog   io.Writer
+	trafficLogMu sync.Mutex
+)
+
+// openTrafficLog sets trafficLog to the file at path, which is appended to.
+// A path of "-" logs to stderr.
+func openTrafficLog(path string) error {
+	if path == "-" {
+		trafficLog = os.Stderr
+		return nil
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return err
+	}
+	trafficLog = f
+	return nil
+}
+
+// logTraffic logs a message body with a timestamp and a direction marker,
+// "-->" for messages to the adapter and "<--" for messages from it.
+func logTraffic(direction string, body []byte) {
+	if trafficLog == nil {
+		return
+	}
+	var pretty bytes.Buffer
+	if err := json.Indent(&pretty, body, "", "  "); err != nil {
+		pretty.Reset()
+		pretty.Write(body)
+	}
+	trafficLogMu.Lock()
+	defer trafficLogMu.Unlock()
+	fmt.Fprintf(trafficLog, "%s %s\n%s\n\n", time.Now().Format(time.RFC3339Nano), direction, pretty.Bytes())
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// withRetries calls dial until it succeeds or opts.ConnectRetries more
+// attempts have failed, in which case it returns the last error.
+func withRetries(opts *Options, addr string, dial func(string) (io.ReadWriteCloser, error)) (io.ReadWriteCloser, error) {
+	conn, err := dial(addr)
+	for i := 0; err != nil && i < opts.ConnectRetries; i++ {
+		if i == 0 {
+			fmt.Fprintf(os.Stderr, "waiting for adapter at %s...\n", addr)
+		}
+		time.Sleep(opts.ConnectInterval)
+		conn, err = dial(addr)
+	}
+	return conn, err
+}
+
+// dialTCP connects to an adapter listening on addr.
+func dialTCP(addr string) (io.ReadWriteCloser, error) {
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to dial %s: %s", addr, err)
+	}
+	return conn, nil
+}
+
+// dialUnix connects to an adapter listening on the Unix socket at path.
+func dialUnix(path string) (io.ReadWriteCloser, error) {
+	conn, err := net.Dial("unix", path)
+	switch {
+	case errors.Is(err, syscall.ENOENT):
+		return nil, fmt.Errorf("no socket at %s; is the adapter running?", path)
+	case isConnRefused(err):
+		return nil, fmt.Errorf("connection to %s refused; the adapter may have exited and left the socket behind", path)
+	case err != nil:
+		return nil, fmt.Errorf("failed to dial %s: %s", path, err)
+	}
+	return conn, nil
+}
+
+// stdioTransport talks to an adapter running as a child process over its
+// stdin and stdout.
+type stdioTransport struct {
+	stdout io.Reader
+	io.WriteCloser
+	cmd *exec.Cmd
+	// exited is closed once the adapter has been waited for, and err is
+	// what waiting for it returned. That happens when reading its stdout
+	// first fails, since os/exec says not to wait while still reading.
+	exited chan struct{}
+	once   sync.Once
+	err    error
+}
+
+// adapterExitTimeout is how long Close gives the adapter to exit after its
+// stdin is closed, before killing it.
+const adapterExitTimeout = 5 * time.Second
+
+// startStdio starts the adapter given by args as a child process. Its
+// stderr is passed through to ours.
+func startStdio(args []string) (io.ReadWriteCloser, error) {
+	if len(args) == 0 {
+		return nil, fmt.Errorf("no adapter command given")
+	}
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Stderr = os.Stderr
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("failed to start %s: %s", args[0], err)
+	}
+	return &stdioTransport{stdout: stdout, WriteCloser: stdin, cmd: cmd, exited: make(chan struct{})}, nil
+}
+
+func (t *stdioTransport) Read(p []byte) (int, error) {
+	n, err := t.stdout.Read(p)
+	if err != nil {
+		// This is the last read, so the adapter can be waited for.
+		t.once.Do(t.wait)
+	}
+	return n, err
+}
+
+func (t *stdioTransport) wait() {
+	t.err = t.cmd.Wait()
+	close(t.exited)
+}
+
+// Close closes the adapter's stdin and waits for it to exit, which the
+// reader sees as the end of its stdout. An adapter that doesn't exit in time
+// is killed.
+func (t *stdioTransport) Close() error {
+	if err := t.WriteCloser.Close(); err != nil {
+		return err
+	}
+	select {
+	case <-t.exited:
+	case <-time.After(adapterExitTimeout):
+		t.cmd.Process.Kill()
+		<-t.exited
+	}
+	return t.err
+}
+
+const usage = `usage: dap-cli [options] [--tcp] <host:port>
+       dap-cli [options] --unix <socket path>
+       dap-cli [options] --pipe <pipe name>   (Windows only)
+       dap-cli [options] --stdio -- <adapter command...>
+       dap-cli [options] --config-name <name>
+
+options:
+  --version             print the version and exit
+  --timeout <duration>  how long to wait for each response (default 10s)
+  --connect-retries <n> how many more times to try connecting to the
+                        adapter if the first attempt fails (default 0)
+  --connect-interval <duration>
+                        how long to wait between attempts (default 500ms)
+  --adapter-id <id>     the adapter ID to initialize with; for delve,
+                        debugpy, and node, launch arguments are also
+                        checked for common mistakes
+  --color <mode>        auto, always, or never (default auto)
+  --output <mode>       text or json; json prints one object per line for
+                        bt, vars, eval, threads, errors, and events
+  --history-file <path> where to save command history, or empty to not save
+                        it (default ~/.dap-cli_history)
+  --log-file <path>     log all protocol messages to path, or - for stderr;
+                        messages are logged verbatim, including launch
+                        arguments and environment
+  --config <path>       where to find named configurations (default
+                        .dap-cli.json)
+  --config-name <name>  connect and launch or attach as the named
+                        configuration says
+  --script <file>       run the commands in file, then quit; commands are
+                        also read from stdin when it isn't a terminal
+  --stop-on-error       stop a script at the first command that fails
+  --no-auto-stack       don't fetch the stack trace each time a thread
+                        stops
+  --dry-run             print the requests commands would send without
+                        connecting to an adapter
+  --no-debug            launch programs without debugging, just showing
+                        their output
+  --auto-restart        relaunch the debuggee when the adapter asks for a
+                        restart`
+
+// errUsage is returned for command-line arguments that don't make sense, in
+// response to which the usage is printed.
+var errUsage = errors.New("bad arguments")
+
+// transportFlags are the arguments that select how to connect to the
+// adapter. They end the options.
+var transportFlags = map[string]bool{
+	"--tcp":   true,
+	"--unix":  true,
+	"--pipe":  true,
+	"--stdio": true,
+}
+
+// openTransport connects to an adapter as described by the command-line
+// arguments.
+func openTransport(opts *Options, args []string) (io.ReadWriteCloser, error) {
+	if len(args) == 0 {
+		return nil, errUsage
+	}
+	switch args[0] {
+	case "--stdio":
+		args = args[1:]
+		if len(args) > 0 && args[0] == "--" {
+			args = args[1:]
+		}
+		return startStdio(args)
+	case "--tcp":
+		if len(args) != 2 {
+			return nil, errUsage
+		}
+		return withRetries(opts, args[1], dialTCP)
+	case "--unix":
+		if len(args) != 2 {
+			return nil, errUsage
+		}
+		return withRetries(opts, args[1], dialUnix)
+	case "--pipe":
+		if len(args) != 2 {
+			return nil, errUsage
+		}
+		return openPipe(opts, args[1])
+	default:
+		return withRetries(opts, args[0], dialTCP)
+	}
+}
@@ -0,0 +1,593 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+type Scope struct {
+	Name               string `json:"name"`
+	VariablesReference int    `json:"variablesReference"`
+	Expensive          bool   `json:"expensive"`
+}
+
+type ScopesArgs struct {
+	FrameID int `json:"frameId"`
+}
+
+type ScopesResponseBody struct {
+	Scopes []Scope `json:"scopes"`
+}
+
+func ScopesRequest(args ScopesArgs) Request {
+	return Request{
+		ProtocolMessage: NewRequest(),
+		Command:         "scopes",
+		Arguments:       args,
+	}
+}
+
+type Variable struct {
+	Name               string `json:"name"`
+	Value              string `json:"value"`
+	Type               string `json:"type"`
+	VariablesReference int    `json:"variablesReference"`
+	// IndexedVariables and NamedVariables are the number of children of
+	// each kind, if the adapter says, so that large ones can be paged.
+	IndexedVariables int `json:"indexedVariables,omitempty"`
+	NamedVariables   int `json:"namedVariables,omitempty"`
+}
+
+// variablesPageSize is how many indexed children are fetched at once from a
+// variable that has more than that.
+const variablesPageSize = 100
+
+// ValueFormat asks the adapter to format values a certain way. It is only
+// sent if the adapter supports value formatting options.
+type ValueFormat struct {
+	Hex bool `json:"hex,omitempty"`
+}
+
+// valueFormat returns the format set with the format command, or nil if
+// there's nothing to ask for.
+func valueFormat(s *Session) *ValueFormat {
+	if !s.getHexFormat() || !s.getCapabilities().SupportsValueFormattingOptions {
+		return nil
+	}
+	return &ValueFormat{Hex: true}
+}
+
+type VariablesArgs struct {
+	VariablesReference int `json:"variablesReference"`
+	// Filter is "indexed" or "named" to fetch only children of that kind,
+	// and Start and Count select a page of them.
+	Filter string       `json:"filter,omitempty"`
+	Start  int          `json:"start,omitempty"`
+	Count  int          `json:"count,omitempty"`
+	Format *ValueFormat `json:"format,omitempty"`
+}
+
+type VariablesResponseBody struct {
+	Variables []Variable `json:"variables"`
+}
+
+func VariablesRequest(args VariablesArgs) Request {
+	return Request{
+		ProtocolMessage: NewRequest(),
+		Command:         "variables",
+		Arguments:       args,
+	}
+}
+
+type SetVariableArgs struct {
+	VariablesReference int    `json:"variablesReference"`
+	Name               string `json:"name"`
+	Value              string `json:"value"`
+}
+
+type SetVariableResponseBody struct {
+	Value              string `json:"value"`
+	Type               string `json:"type"`
+	VariablesReference int    `json:"variablesReference"`
+}
+
+func SetVariableRequest(args SetVariableArgs) Request {
+	return Request{
+		ProtocolMessage: NewRequest(),
+		Command:         "setVariable",
+		Arguments:       args,
+	}
+}
+
+type SetExpressionArgs struct {
+	Expression string `json:"expression"`
+	Value      string `json:"value"`
+	FrameID    int    `json:"frameId,omitempty"`
+}
+
+type SetExpressionResponseBody struct {
+	Value              string `json:"value"`
+	Type               string `json:"type"`
+	VariablesReference int    `json:"variablesReference"`
+}
+
+func SetExpressionRequest(args SetExpressionArgs) Request {
+	return Request{
+		ProtocolMessage: NewRequest(),
+		Command:         "setExpression",
+		Arguments:       args,
+	}
+}
+
+type EvaluateArgs struct {
+	Expression string `json:"expression"`
+	FrameID    int    `json:"frameId,omitempty"`
+	// Context is one of "watch", "repl", or "hover". EvaluateRequest
+	// defaults it to "repl".
+	Context string       `json:"context,omitempty"`
+	Format  *ValueFormat `json:"format,omitempty"`
+}
+
+type EvaluateResponseBody struct {
+	Result             string `json:"result"`
+	Type               string `json:"type"`
+	VariablesReference int    `json:"variablesReference"`
+}
+
+func EvaluateRequest(args EvaluateArgs) Request {
+	if args.Context == "" {
+		args.Context = "repl"
+	}
+	return Request{
+		ProtocolMessage: NewRequest(),
+		Command:         "evaluate",
+		Arguments:       args,
+	}
+}
+
+func scopes(s *Session, frameID int) ([]Scope, error) {
+	req := ScopesRequest(ScopesArgs{FrameID: frameID})
+	resp, err := sendAndWait(s, req)
+	if err != nil {
+		return nil, err
+	}
+	var body ScopesResponseBody
+	if err := json.Unmarshal(resp.Body, &body); err != nil {
+		return nil, fmt.Errorf("failed to read scopes: %s", err)
+	}
+	return body.Scopes, nil
+}
+
+// variables fetches the children of ref. If ref is known to have more indexed
+// children than fit on a page, only the first page is fetched.
+func variables(s *Session, ref int) ([]Variable, error) {
+	if s.indexedCount(ref) > variablesPageSize {
+		return variablesPage(s, ref, 1)
+	}
+	return fetchVariables(s, VariablesArgs{VariablesReference: ref})
+}
+
+// variablesPage fetches the nth page of ref's indexed children, counting
+// from 1.
+func variablesPage(s *Session, ref, page int) ([]Variable, error) {
+	return fetchVariables(s, VariablesArgs{
+		VariablesReference: ref,
+		Filter:             "indexed",
+		Start:              (page - 1) * variablesPageSize,
+		Count:              variablesPageSize,
+	})
+}
+
+func fetchVariables(s *Session, args VariablesArgs) ([]Variable, error) {
+	args.Format = valueFormat(s)
+	resp, err := sendAndWait(s, VariablesRequest(args))
+	if err != nil {
+		return nil, err
+	}
+	var body VariablesResponseBody
+	if err := json.Unmarshal(resp.Body, &body); err != nil {
+		return nil, fmt.Errorf("failed to read variables: %s", err)
+	}
+	s.setIndexedCounts(body.Variables)
+	return body.Variables, nil
+}
+
+// printPageHint says how to see more of ref's children if only a page of
+// them was shown.
+func printPageHint(s *Session, ref, page int, indent string) {
+	total := s.indexedCount(ref)
+	if total <= page*variablesPageSize {
+		return
+	}
+	fmt.Fprintf(s.opts.Out, "%s(showing %d-%d of %d, use vars %d page %d for more)\n", indent,
+		(page-1)*variablesPageSize, page*variablesPageSize-1, total, ref, page+1)
+}
+
+func printVariables(s *Session, vars []Variable, indent string) {
+	for _, v := range vars {
+		line := fmt.Sprintf("%s%s = %s", indent, v.Name, v.Value)
+		if v.Type != "" {
+			line += fmt.Sprintf(" (%s)", v.Type)
+		}
+		switch {
+		case v.VariablesReference != 0 && v.IndexedVariables > variablesPageSize:
+			line += fmt.Sprintf(" [ref %d, %d elements]", v.VariablesReference, v.IndexedVariables)
+		case v.VariablesReference != 0:
+			line += fmt.Sprintf(" [ref %d]", v.VariablesReference)
+		}
+		fmt.Fprintln(s.opts.Out, line)
+	}
+}
+
+func varsCommand(s *Session, args []string) error {
+	if len(args) > 0 {
+		return varsPageCommand(s, args)
+	}
+	frame, err := currentFrame(s)
+	if err != nil {
+		return err
+	}
+	frameScopes, err := scopes(s, frame.ID)
+	if err != nil {
+		return err
+	}
+	if s.opts.JSON {
+		printScopesJSON(s, frameScopes)
+		return nil
+	}
+	// A scope that can't be read doesn't stop the others being shown.
+	var failed error
+	for _, scope := range frameScopes {
+		if scope.Expensive {
+			fmt.Fprintf(s.opts.Out, "%s: (expensive, use expand %d)\n", scope.Name, scope.VariablesReference)
+			continue
+		}
+		// The scope's reference is what set needs to change its variables.
+		fmt.Fprintf(s.opts.Out, "%s [ref %d]:\n", scope.Name, scope.VariablesReference)
+		vars, err := variables(s, scope.VariablesReference)
+		if err != nil {
+			failed = err
+			continue
+		}
+		printVariables(s, vars, "  ")
+	}
+	return failed
+}
+
+// varsPageCommand handles vars <ref> page <n>.
+func varsPageCommand(s *Session, args []string) error {
+	if len(args) != 3 || args[1] != "page" {
+		return errors.New("usage: vars [<ref> page <n>]")
+	}
+	ref, err := strconv.Atoi(args[0])
+	if err != nil {
+		return fmt.Errorf("bad variables reference %q", args[0])
+	}
+	page, err := strconv.Atoi(args[2])
+	if err != nil || page < 1 {
+		return fmt.Errorf("bad page number %q", args[2])
+	}
+	vars, err := variablesPage(s, ref, page)
+	if err != nil {
+		return err
+	}
+	if len(vars) == 0 {
+		fmt.Fprintf(s.opts.Out, "no variables on page %d\n", page)
+		return nil
+	}
+	printVariables(s, vars, "")
+	printPageHint(s, ref, page, "")
+	return nil
+}
+
+// ScopeResult is an entry in the body of the vars command's result in JSON
+// mode. Variables are omitted for expensive scopes.
+type ScopeResult struct {
+	Scope     Scope      `json:"scope"`
+	Variables []Variable `json:"variables,omitempty"`
+}
+
+func printScopesJSON(s *Session, frameScopes []Scope) {
+	results := make([]ScopeResult, len(frameScopes))
+	for i, scope := range frameScopes {
+		results[i].Scope = scope
+		if scope.Expensive {
+			continue
+		}
+		vars, err := variables(s, scope.VariablesReference)
+		if err != nil {
+			printResult(s, "vars", nil, err)
+			return
+		}
+		results[i].Variables = vars
+	}
+	printResult(s, "vars", results, nil)
+}
+
+// findScope returns the first scope whose name matches one of names,
+// ignoring case, since adapters don't agree on what to call them.
+func findScope(frameScopes []Scope, names ...string) (Scope, bool) {
+	for _, name := range names {
+		for _, scope := range frameScopes {
+			if strings.EqualFold(scope.Name, name) {
+				return scope, true
+			}
+		}
+	}
+	return Scope{}, false
+}
+
+// scopeVariables prints the variables of one of the current frame's scopes.
+func scopeVariables(s *Session, scope Scope) error {
+	vars, err := variables(s, scope.VariablesReference)
+	if err != nil {
+		return err
+	}
+	if len(vars) == 0 {
+		fmt.Fprintf(s.opts.Out, "no variables in %s\n", scope.Name)
+		return nil
+	}
+	printVariables(s, vars, "")
+	return nil
+}
+
+func localsCommand(s *Session, args []string) error {
+	frame, err := currentFrame(s)
+	if err != nil {
+		return err
+	}
+	frameScopes, err := scopes(s, frame.ID)
+	if err != nil {
+		return err
+	}
+	scope, ok := findScope(frameScopes, "Locals", "Local")
+	if !ok {
+		// Fall back to the first scope that's cheap to fetch.
+		for _, sc := range frameScopes {
+			if !sc.Expensive {
+				scope, ok = sc, true
+				break
+			}
+		}
+	}
+	if !ok {
+		fmt.Fprintln(s.opts.Out, "no local scope")
+		return nil
+	}
+	return scopeVariables(s, scope)
+}
+
+func argsCommand(s *Session, args []string) error {
+	frame, err := currentFrame(s)
+	if err != nil {
+		return err
+	}
+	frameScopes, err := scopes(s, frame.ID)
+	if err != nil {
+		return err
+	}
+	scope, ok := findScope(frameScopes, "Arguments", "Parameters", "Args")
+	if !ok {
+		fmt.Fprintln(s.opts.Out, "no arguments scope")
+		return nil
+	}
+	return scopeVariables(s, scope)
+}
+
+func expandCommand(s *Session, args []string) error {
+	if len(args) != 1 {
+		return errors.New("usage: expand <ref>")
+	}
+	ref, err := strconv.Atoi(args[0])
+	if err != nil {
+		return fmt.Errorf("bad variables reference %q", args[0])
+	}
+	vars, err := variables(s, ref)
+	if err != nil {
+		return err
+	}
+	printVariables(s, vars, "")
+	printPageHint(s, ref, 1, "")
+	return nil
+}
+
+const (
+	// defaultTreeDepth is how many levels tree expands when not told.
+	defaultTreeDepth = 2
+	// maxTreeNodes caps how many variables tree prints so a huge structure
+	// doesn't flood the terminal.
+	maxTreeNodes = 500
+)
+
+func treeCommand(s *Session, args []string) error {
+	if len(args) < 1 || len(args) > 2 {
+		return errors.New("usage: tree <ref> [depth]")
+	}
+	ref, err := strconv.Atoi(args[0])
+	if err != nil {
+		return fmt.Errorf("bad variables reference %q", args[0])
+	}
+	depth := defaultTreeDepth
+	if len(args) == 2 {
+		if depth, err = strconv.Atoi(args[1]); err != nil || depth < 1 {
+			return fmt.Errorf("bad depth %q", args[1])
+		}
+	}
+	if scope, ok := findScopeByRef(s, ref); ok && scope.Expensive {
+		fmt.Fprintf(s.opts.Out, "%s is expensive, use expand %d\n", scope.Name, ref)
+		return nil
+	}
+	nodes := 0
+	seen := map[int]bool{ref: true}
+	err = printTree(s, ref, depth, "", seen, &nodes)
+	if nodes >= maxTreeNodes {
+		fmt.Fprintf(s.opts.Out, "(stopped after %d variables)\n", maxTreeNodes)
+	}
+	return err
+}
+
+// findScopeByRef looks for ref among the current frame's scopes, so that tree
+// doesn't fetch an expensive scope by accident.
+func findScopeByRef(s *Session, ref int) (Scope, bool) {
+	frame, err := currentFrame(s)
+	if err != nil {
+		return Scope{}, false
+	}
+	frameScopes, err := scopes(s, frame.ID)
+	if err != nil {
+		return Scope{}, false
+	}
+	for _, scope := range frameScopes {
+		if scope.VariablesReference == ref {
+			return scope, true
+		}
+	}
+	return Scope{}, false
+}
+
+// printTree prints the variables under ref and, up to depth levels, their
+// children. seen holds the references on the path from the root, so cycles
+// are printed once and not followed.
+func printTree(s *Session, ref, depth int, indent string, seen map[int]bool, nodes *int) error {
+	vars, err := variables(s, ref)
+	if err != nil {
+		return err
+	}
+	for _, v := range vars {
+		if *nodes >= maxTreeNodes {
+			return nil
+		}
+		*nodes++
+		printVariables(s, []Variable{v}, indent)
+		if v.VariablesReference == 0 || depth <= 1 {
+			continue
+		}
+		if seen[v.VariablesReference] {
+			fmt.Fprintf(s.opts.Out, "%s  (cycle)\n", indent)
+			continue
+		}
+		seen[v.VariablesReference] = true
+		err := printTree(s, v.VariablesReference, depth-1, indent+"  ", seen, nodes)
+		delete(seen, v.VariablesReference)
+		if err != nil {
+			return err
+		}
+	}
+	printPageHint(s, ref, 1, indent)
+	return nil
+}
+
+func evalCommand(s *Session, args []string) error {
+	if len(args) == 0 {
+		return errors.New("usage: eval <expression>")
+	}
+	expr := strings.Join(args, " ")
+	evalArgs := EvaluateArgs{Expression: expr, Format: valueFormat(s)}
+	if frame, ok := s.getSelectedFrame(); ok {
+		evalArgs.FrameID = frame.ID
+	}
+	req := EvaluateRequest(evalArgs)
+	resp, err := sendAndWait(s, req)
+	if err != nil {
+		return err
+	}
+	var body EvaluateResponseBody
+	if err := json.Unmarshal(resp.Body, &body); err != nil {
+		return fmt.Errorf("failed to read evaluate response: %s", err)
+	}
+	if s.opts.JSON {
+		printResult(s, "eval", body, nil)
+		return nil
+	}
+	printVariables(s, []Variable{{
+		Name:               expr,
+		Value:              body.Result,
+		Type:               body.Type,
+		VariablesReference: body.VariablesReference,
+	}}, "")
+	return nil
+}
+
+func setCommand(s *Session, args []string) error {
+	if len(args) > 0 && args[0] == "repeat" {
+		return setRepeatCommand(s, args[1:])
+	}
+	const usage = "usage: set <ref> <name> = <value>"
+	if len(args) < 2 {
+		return fmt.Errorf("%s", usage)
+	}
+	ref, err := strconv.Atoi(args[0])
+	if err != nil {
+		return fmt.Errorf("bad variables reference %q", args[0])
+	}
+	name, value, ok := strings.Cut(strings.Join(args[1:], " "), "=")
+	name, value = strings.TrimSpace(name), strings.TrimSpace(value)
+	if !ok || name == "" || value == "" {
+		return fmt.Errorf("%s", usage)
+	}
+	req := SetVariableRequest(SetVariableArgs{VariablesReference: ref, Name: name, Value: value})
+	resp, err := sendAndWait(s, req)
+	if err != nil {
+		return err
+	}
+	var body SetVariableResponseBody
+	if err := json.Unmarshal(resp.Body, &body); err != nil {
+		return fmt.Errorf("failed to read setVariable response: %s", err)
+	}
+	printVariables(s, []Variable{{
+		Name:               name,
+		Value:              body.Value,
+		Type:               body.Type,
+		VariablesReference: body.VariablesReference,
+	}}, "")
+	return nil
+}
+
+func assignCommand(s *Session, args []string) error {
+	expr, value, ok := strings.Cut(strings.Join(args, " "), "=")
+	expr, value = strings.TrimSpace(expr), strings.TrimSpace(value)
+	if !ok || expr == "" || value == "" {
+		return errors.New("usage: assign <expression> = <value>")
+	}
+	setArgs := SetExpressionArgs{Expression: expr, Value: value}
+	if frame, ok := s.getSelectedFrame(); ok {
+		setArgs.FrameID = frame.ID
+	}
+	resp, err := sendAndWait(s, SetExpressionRequest(setArgs))
+	if err != nil {
+		return err
+	}
+	var body SetExpressionResponseBody
+	if err := json.Unmarshal(resp.Body, &body); err != nil {
+		return fmt.Errorf("failed to read setExpression response: %s", err)
+	}
+	printVariables(s, []Variable{{
+		Name:               expr,
+		Value:              body.Value,
+		Type:               body.Type,
+		VariablesReference: body.VariablesReference,
+	}}, "")
+	return nil
+}
+
+func formatCommand(s *Session, args []string) error {
+	if len(args) == 0 {
+		mode := "off"
+		if s.getHexFormat() {
+			mode = "on"
+		}
+		fmt.Fprintf(s.opts.Out, "hex %s\n", mode)
+		return nil
+	}
+	if len(args) != 2 || args[0] != "hex" || args[1] != "on" && args[1] != "off" {
+		return errors.New("usage: format hex on|off")
+	}
+	s.setHexFormat(args[1] == "on")
+	if !s.getCapabilities().SupportsValueFormattingOptions {
+		fmt.Fprintln(s.opts.Out, "warning: adapter does not support value formatting; values are shown as it formats them")
+	}
+	return nil
+}
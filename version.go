@@ -0,0 +1,36 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Build metadata, set at build time with, for example:
+//
+//	go build -ldflags "-X main.version=0.1.0 -X main.commit=$(git rev-parse --short HEAD) -X main.buildDate=$(date -u +%Y-%m-%d)"
+var (
+	version   = "dev"
+	commit    = "unknown"
+	buildDate = "unknown"
+)
+
+// printVersion prints the build metadata and the protocol features the
+// client implements on its side.
+func printVersion(opts *Options) {
+	fmt.Printf("dap-cli %s (commit %s, built %s)\n", version, commit, buildDate)
+	var features []string
+	if opts.InitializeArgs.SupportsProgressReporting {
+		features = append(features, "progress reporting")
+	}
+	if opts.InitializeArgs.SupportsRunInTerminal {
+		features = append(features, "runInTerminal")
+	}
+	fmt.Printf("client features: %s\n", strings.Join(features, ", "))
+	var reverse []string
+	for command := range reverseRequestHandlers {
+		reverse = append(reverse, command)
+	}
+	sort.Strings(reverse)
+	fmt.Printf("reverse requests: %s\n", strings.Join(reverse, ", "))
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// printWatches evaluates each watch expression in the top frame of the given
+// thread and prints the results. An expression that fails to evaluate
+// doesn't stop the rest from being shown.
+func printWatches(s *Session, threadID int) {
+	watches := s.getWatches()
+	if len(watches) == 0 {
+		return
+	}
+	frames := s.getFrames()
+	if len(frames) == 0 {
+		var err error
+		if frames, err = stackTrace(s, threadID, 1); err != nil {
+			printError(s, "%s", err)
+			return
+		}
+	}
+	if len(frames) == 0 {
+		return
+	}
+	for i, expr := range watches {
+		fmt.Fprintf(s.opts.Out, "%d: %s = %s\n", i+1, expr, evaluateWatch(s, expr, frames[0].ID))
+	}
+}
+
+func evaluateWatch(s *Session, expr string, frameID int) string {
+	req := EvaluateRequest(EvaluateArgs{Expression: expr, FrameID: frameID, Context: "watch", Format: valueFormat(s)})
+	resp, err := sendAndWait(s, req)
+	if err != nil {
+		return colorize(colorRed, "<"+err.Error()+">")
+	}
+	var body EvaluateResponseBody
+	if err := json.Unmarshal(resp.Body, &body); err != nil {
+		return colorize(colorRed, fmt.Sprintf("<failed to read result: %s>", err))
+	}
+	return body.Result
+}
+
+func watchAddCommand(s *Session, args []string) error {
+	if len(args) == 0 {
+		return errors.New("usage: watch-add <expr>")
+	}
+	s.addWatch(strings.Join(args, " "))
+	fmt.Fprintf(s.opts.Out, "watch %d added\n", len(s.getWatches()))
+	return nil
+}
+
+func watchListCommand(s *Session, args []string) error {
+	watches := s.getWatches()
+	if len(watches) == 0 {
+		fmt.Fprintln(s.opts.Out, "no watches")
+		return nil
+	}
+	// Only show values if there's a stopped frame to evaluate them in.
+	var frameID int
+	if _, stopped := s.getCurrentThread(); stopped {
+		if frame, err := currentFrame(s); err == nil {
+			frameID = frame.ID
+		}
+	}
+	for i, expr := range watches {
+		if frameID == 0 {
+			fmt.Fprintf(s.opts.Out, "%d: %s\n", i+1, expr)
+			continue
+		}
+		fmt.Fprintf(s.opts.Out, "%d: %s = %s\n", i+1, expr, evaluateWatch(s, expr, frameID))
+	}
+	return nil
+}
+
+func watchDelCommand(s *Session, args []string) error {
+	if len(args) != 1 {
+		return errors.New("usage: watch-del <n>")
+	}
+	n, err := strconv.Atoi(args[0])
+	if err != nil {
+		return fmt.Errorf("bad watch number %q", args[0])
+	}
+	if !s.removeWatch(n) {
+		return fmt.Errorf("no watch %d", n)
+	}
+	return nil
+}